@@ -1,14 +1,25 @@
 package cli
 
 import (
+	"encoding/json"
 	"fmt"
 	hubbub "github.com/rjz/hubbub/common"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Exit codes reported by `hubbub check`
+const (
+	CheckPassed  = 0
+	CheckDrifted = 1
+	CheckFailed  = 2
 )
 
 func die(message string, err error) {
-	fmt.Println("failed reading policies directory")
+	fmt.Println(message)
 	fmt.Println(err)
 	os.Exit(1)
 }
@@ -34,16 +45,17 @@ func prettyTable(title string, items []string) {
 }
 
 func ListConfigFiles(path string) {
-	ext := ".json"
-	pathGlob := filepath.Join(path, fmt.Sprintf("*%s", ext))
-	matches, err := filepath.Glob(pathGlob)
-	if err != nil {
-		die("failed reading config directory", err)
-	}
 	var items []string
-	for _, v := range matches {
-		basename := filepath.Base(v)
-		items = append(items, basename[0:len(basename)-len(ext)])
+	for _, ext := range hubbub.ConfigExtensions {
+		pathGlob := filepath.Join(path, fmt.Sprintf("*%s", ext))
+		matches, err := filepath.Glob(pathGlob)
+		if err != nil {
+			die("failed reading config directory", err)
+		}
+		for _, v := range matches {
+			basename := filepath.Base(v)
+			items = append(items, basename[0:len(basename)-len(ext)])
+		}
 	}
 	prettyTable(path, items)
 }
@@ -51,5 +63,240 @@ func ListConfigFiles(path string) {
 // printGoals describes all globally-registered goals
 func ListPolicyGoals() {
 	serviceFactories := hubbub.ServiceFactories()
-	prettyTable("goals", serviceFactories.Goals())
+	var items []string
+	for _, d := range serviceFactories.Definitions() {
+		items = append(items, fmt.Sprintf("%s - %s", d.Name, d.Description))
+	}
+	prettyTable("goals", items)
+}
+
+// schemaType names the type of a parameter, e.g. `array[string]`
+func schemaType(s *hubbub.Schema) string {
+	if s.Type == "array" && s.Items != nil && s.Items.Type != "" {
+		return fmt.Sprintf("array[%s]", s.Items.Type)
+	}
+	if s.Type == "" {
+		return "any"
+	}
+	return s.Type
+}
+
+// printParameters tabulates the properties of an object schema
+func printParameters(s *hubbub.Schema) {
+	required := map[string]bool{}
+	for _, key := range s.Required {
+		required[key] = true
+	}
+
+	var keys []string
+	for key := range s.Properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 1, ' ', 0)
+	fmt.Fprintln(w, "  key\t| type\t| description")
+	fmt.Fprintln(w, "  ---\t| ----\t| -----------")
+	for _, key := range keys {
+		prop := s.Properties[key]
+		description := prop.Description
+		if !required[key] {
+			description = strings.TrimSpace("(optional) " + description)
+		}
+		fmt.Fprintf(w, "  `%s`\t| `%s`\t| %s\n", key, schemaType(prop), description)
+	}
+	w.Flush()
+
+	if len(s.OneOf) > 0 {
+		var alternatives []string
+		for _, alt := range s.OneOf {
+			alternatives = append(alternatives, alt.Description)
+		}
+		fmt.Printf("\nParameters must describe exactly one of: %s.\n", strings.Join(alternatives, "; "))
+	}
+}
+
+// DescribeGoal prints the documentation for a registered goal (or for all
+// of them, if goal is empty) as markdown
+func DescribeGoal(goal string) {
+	serviceFactories := hubbub.ServiceFactories()
+	definitions := serviceFactories.Definitions()
+	if goal != "" {
+		d, err := serviceFactories.Definition(goal)
+		if err != nil {
+			die("unknown goal", err)
+		}
+		definitions = []hubbub.GoalDefinition{*d}
+	}
+
+	for _, d := range definitions {
+		fmt.Printf("### `%s`\n\n", d.Name)
+		if d.Description != "" {
+			fmt.Printf("%s\n\n", d.Description)
+		}
+
+		if d.Schema != nil && len(d.Schema.Properties) > 0 {
+			fmt.Print("#### Parameters\n\n")
+			printParameters(d.Schema)
+			fmt.Println("")
+		}
+
+		if d.Example != "" {
+			fmt.Print("#### Example\n\n")
+			fmt.Printf("    \"%s\": %s\n\n", d.Name, strings.Replace(d.Example, "\n", "\n    ", -1))
+		}
+	}
+}
+
+// ValidatePolicy checks each goal in a policy against the schema supplied by
+// its service, listing any problems and returning a non-zero exit code if
+// there were any
+func ValidatePolicy(policyFile string, policy hubbub.Policy) int {
+	serviceFactories := hubbub.ServiceFactories()
+	errs := serviceFactories.Validate(policy)
+	if len(errs) == 0 {
+		prettyTable(policyFile, []string{fmt.Sprintf("%d goals OK", len(policy))})
+		return 0
+	}
+
+	var items []string
+	for _, err := range errs {
+		items = append(items, err.Error())
+	}
+	prettyTable(policyFile, items)
+	return 1
+}
+
+// ListResults describes the changes recorded (and goals skipped) while
+// applying a policy to a repository
+func ListResults(repoURL string, results []hubbub.GoalResult) {
+	var items []string
+	for _, r := range results {
+		if r.IsSkipped() {
+			items = append(items, fmt.Sprintf("skipped %s (%s)", r.Goal, r.SkipReason))
+			continue
+		}
+
+		for _, c := range r.Changes {
+			items = append(items, c.String())
+		}
+	}
+	prettyTable(repoURL, items)
+}
+
+// PrintSummary tabulates the outcome of each session and returns an exit code
+// reflecting whether any of them failed
+func PrintSummary(sessions []*hubbub.Session) int {
+	var failures []string
+	prettyListHeader("summary")
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "  repository\tgoals\tchanged\tunchanged\tskipped\tfailed\t")
+	for _, sess := range sessions {
+		repoURL := sess.Facts.GetString("repo.url")
+		changed, unchanged := 0, 0
+		for _, c := range sess.Changes() {
+			if c.IsChanged() {
+				changed++
+			} else {
+				unchanged++
+			}
+		}
+
+		skipped := 0
+		for _, r := range sess.Results {
+			if r.IsSkipped() {
+				skipped++
+			}
+		}
+
+		failed := len(sess.Failures())
+		for _, r := range sess.Failures() {
+			failures = append(failures, fmt.Sprintf("%s: %s: %s", repoURL, r.Goal, r.Err))
+		}
+
+		if sess.Err != nil && failed == 0 {
+			// the session failed before any goals were attempted
+			failed = len(*sess.Policy)
+			failures = append(failures, fmt.Sprintf("%s: %s", repoURL, sess.Err))
+		}
+
+		fmt.Fprintf(w, "  %s\t%d\t%d\t%d\t%d\t%d\t\n", repoURL, len(*sess.Policy), changed, unchanged, skipped, failed)
+	}
+	w.Flush()
+	prettyListFooter()
+
+	if len(failures) > 0 {
+		prettyTable("failures", failures)
+		return 1
+	}
+	return 0
+}
+
+// goalFailure describes a goal that couldn't be evaluated
+type goalFailure struct {
+	Goal  string `json:"goal"`
+	Error string `json:"error"`
+}
+
+// repositoryDrift summarizes a single repository's compliance with a policy
+type repositoryDrift struct {
+	URL      string          `json:"url"`
+	Drifted  bool            `json:"drifted"`
+	Error    string          `json:"error,omitempty"`
+	Failures []goalFailure   `json:"failures,omitempty"`
+	Drift    []hubbub.Change `json:"drift"`
+}
+
+// checkSummary summarizes compliance across a list of repositories
+type checkSummary struct {
+	Drifted      bool              `json:"drifted"`
+	Failed       bool              `json:"failed"`
+	Repositories []repositoryDrift `json:"repositories"`
+}
+
+// PrintCheckSummary writes a JSON summary of drift found in (dry-run)
+// sessions and returns the corresponding exit code
+func PrintCheckSummary(sessions []*hubbub.Session) int {
+	summary := checkSummary{Repositories: []repositoryDrift{}}
+	for _, sess := range sessions {
+		rd := repositoryDrift{
+			URL:     sess.Facts.GetString("repo.url"),
+			Drifted: sess.IsDrifted(),
+			Drift:   []hubbub.Change{},
+		}
+
+		for _, c := range sess.Changes() {
+			if c.IsChanged() {
+				rd.Drift = append(rd.Drift, c)
+			}
+		}
+
+		for _, r := range sess.Failures() {
+			rd.Failures = append(rd.Failures, goalFailure{r.Goal, r.Err.Error()})
+		}
+
+		if sess.Err != nil {
+			rd.Error = sess.Err.Error()
+			summary.Failed = true
+		}
+
+		summary.Drifted = summary.Drifted || rd.Drifted
+		summary.Repositories = append(summary.Repositories, rd)
+	}
+
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		die("failed writing summary", err)
+	}
+	fmt.Println(string(data))
+
+	switch {
+	case summary.Failed:
+		return CheckFailed
+	case summary.Drifted:
+		return CheckDrifted
+	default:
+		return CheckPassed
+	}
 }
@@ -0,0 +1,32 @@
+package common
+
+import "fmt"
+
+// Action describes what a service did--or, in a dry run, would do--to a
+// resource
+type Action string
+
+const (
+	Create    Action = "create"
+	Update    Action = "update"
+	Delete    Action = "delete"
+	Unchanged Action = "unchanged"
+)
+
+// Change records the outcome of a goal for a single resource
+type Change struct {
+	Goal     string      `json:"goal"`
+	Resource string      `json:"resource"`
+	Action   Action      `json:"action"`
+	Before   interface{} `json:"before,omitempty"`
+	After    interface{} `json:"after,omitempty"`
+}
+
+// IsChanged reports whether the change modified (or would modify) a resource
+func (c *Change) IsChanged() bool {
+	return c.Action != Unchanged
+}
+
+func (c *Change) String() string {
+	return fmt.Sprintf("%s %s '%s'", c.Action, c.Goal, c.Resource)
+}
@@ -0,0 +1,129 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Condition operators
+const (
+	conditionPresent = "present"
+	conditionAbsent  = "absent"
+	conditionEq      = "=="
+	conditionNe      = "!="
+	conditionIn      = "in"
+	conditionNotIn   = "not in"
+)
+
+var (
+	presenceCondition   = regexp.MustCompile(`^\s*(!?)\s*([\w.]+)\s*$`)
+	comparisonCondition = regexp.MustCompile(`^\s*([\w.]+)\s*(==|!=)\s*(.+?)\s*$`)
+	membershipCondition = regexp.MustCompile(`^\s*([\w.]+)\s+(not\s+in|in)\s+\[(.*)\]\s*$`)
+)
+
+// Condition tests a single fact, e.g. `repo.owner == platform`, `repo.language
+// in [go, ruby]`, or `repo.team` (the fact is present)
+type Condition struct {
+	Fact   string
+	Op     string
+	Values []string
+	source string
+}
+
+// unquote strips whitespace and (optional) quotes from a value
+func unquote(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// ParseCondition reads a condition from its string representation
+func ParseCondition(s string) (*Condition, error) {
+	if m := presenceCondition.FindStringSubmatch(s); m != nil {
+		op := conditionPresent
+		if m[1] == "!" {
+			op = conditionAbsent
+		}
+		return &Condition{Fact: m[2], Op: op, source: s}, nil
+	}
+
+	if m := membershipCondition.FindStringSubmatch(s); m != nil {
+		op := conditionIn
+		if m[2] != conditionIn {
+			op = conditionNotIn
+		}
+
+		var values []string
+		for _, v := range strings.Split(m[3], ",") {
+			if v = unquote(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		return &Condition{Fact: m[1], Op: op, Values: values, source: s}, nil
+	}
+
+	if m := comparisonCondition.FindStringSubmatch(s); m != nil {
+		return &Condition{Fact: m[1], Op: m[2], Values: []string{unquote(m[3])}, source: s}, nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("invalid condition '%s'", s))
+}
+
+// Eval tests the condition against facts
+func (c *Condition) Eval(f *Facts) bool {
+	if !f.IsAvailable(c.Fact) {
+		return c.Op == conditionAbsent || c.Op == conditionNe || c.Op == conditionNotIn
+	}
+
+	value := fmt.Sprint(f.Get(c.Fact))
+	switch c.Op {
+	case conditionPresent:
+		return true
+	case conditionEq, conditionIn:
+		return contains(c.Values, value)
+	case conditionNe, conditionNotIn:
+		return !contains(c.Values, value)
+	default:
+		return false
+	}
+}
+
+func (c *Condition) String() string {
+	return strings.TrimSpace(c.source)
+}
+
+func contains(values []string, v string) bool {
+	for _, candidate := range values {
+		if candidate == v {
+			return true
+		}
+	}
+	return false
+}
+
+// parseConditions reads the `when` clause of a policy entry, which may be a
+// single condition or a list of conditions that must all be met
+func parseConditions(raw json.RawMessage) ([]Condition, error) {
+	var sources []string
+	var source string
+	if err := json.Unmarshal(raw, &source); err == nil {
+		sources = []string{source}
+	} else if err := json.Unmarshal(raw, &sources); err != nil {
+		return nil, errors.New("when must be a condition or a list of conditions")
+	}
+
+	var conditions []Condition
+	for _, s := range sources {
+		c, err := ParseCondition(s)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, *c)
+	}
+	return conditions, nil
+}
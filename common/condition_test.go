@@ -0,0 +1,69 @@
+package common
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func conditionFacts() *Facts {
+	return NewFacts(map[string]interface{}{
+		"repo.owner":    "platform",
+		"repo.language": "go",
+		"repo.tier":     1,
+	})
+}
+
+func TestConditionEval(t *testing.T) {
+	cases := map[string]bool{
+		`repo.owner == platform`:            true,
+		`repo.owner == "platform"`:          true,
+		`repo.owner != platform`:            false,
+		`repo.tier == 1`:                    true,
+		`repo.language in [go, ruby]`:       true,
+		`repo.language in ["ruby", 'node']`: false,
+		`repo.language not in [ruby]`:       true,
+		`repo.owner`:                        true,
+		`repo.team`:                         false,
+		`!repo.team`:                        true,
+		`!repo.owner`:                       false,
+		`repo.team == platform`:             false,
+		`repo.team != platform`:             true,
+		`repo.team in [platform]`:           false,
+		`repo.team not in [platform]`:       true,
+	}
+
+	for source, expected := range cases {
+		c, err := ParseCondition(source)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if c.Eval(conditionFacts()) != expected {
+			t.Error("expected", expected, "for", source)
+		}
+	}
+}
+
+func TestParseConditionInvalid(t *testing.T) {
+	for _, source := range []string{"", "repo.owner =", "repo.owner ~= platform"} {
+		if _, err := ParseCondition(source); err == nil {
+			t.Error("expected error for", source)
+		}
+	}
+}
+
+func TestParsePolicyGoalWhen(t *testing.T) {
+	pg, err := parsePolicyGoal(map[string]json.RawMessage{
+		"when":   json.RawMessage(`["repo.owner == platform", "repo.team"]`),
+		"foo_do": json.RawMessage(`{}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unmet := pg.Unmet(conditionFacts())
+	if unmet == nil || unmet.String() != "repo.team" {
+		t.Error("expected 'repo.team' to be unmet, got", unmet)
+	}
+}
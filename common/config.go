@@ -0,0 +1,130 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// ConfigExtensions lists the extensions of supported config formats, in the
+// order they're preferred when resolving a config name
+var ConfigExtensions = []string{".json", ".yaml", ".yml"}
+
+// ResolveConfigFile finds the file in dir defining the named config
+func ResolveConfigFile(dir, name string) (string, error) {
+	for _, ext := range ConfigExtensions {
+		filename := filepath.Join(dir, name+ext)
+		if _, err := os.Stat(filename); err == nil {
+			return filename, nil
+		}
+	}
+	return "", errors.New(fmt.Sprintf("no config named '%s' in '%s'", name, dir))
+}
+
+// readConfig reads a JSON (with comments) or YAML file, selected by
+// extension, and returns its contents as plain JSON
+func readConfig(filename string) ([]byte, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	switch filepath.Ext(filename) {
+	case ".yaml", ".yml":
+		return yamlToJson(data)
+	default:
+		return stripJsonComments(data), nil
+	}
+}
+
+// yamlToJson converts a YAML document to JSON
+func yamlToJson(data []byte) ([]byte, error) {
+	var parsed interface{}
+	if err := yaml.Unmarshal(data, &parsed); err != nil {
+		return nil, err
+	}
+
+	normalized, err := normalizeYaml(parsed)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(normalized)
+}
+
+// normalizeYaml converts the generic maps produced by the YAML parser into
+// maps that can be encoded as JSON
+func normalizeYaml(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for k, item := range v {
+			key, ok := k.(string)
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("unsupported key '%v'", k))
+			}
+
+			normalized, err := normalizeYaml(item)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = normalized
+		}
+		return m, nil
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			normalized, err := normalizeYaml(item)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = normalized
+		}
+		return list, nil
+	default:
+		return v, nil
+	}
+}
+
+// stripJsonComments removes `//` and `/* */` comments appearing outside of
+// strings in a JSON document
+func stripJsonComments(data []byte) []byte {
+	var out []byte
+	inString, escaped := false, false
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case inString:
+			out = append(out, c)
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+			out = append(out, c)
+		case c == '/' && i+1 < len(data) && data[i+1] == '/':
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+			if i < len(data) {
+				out = append(out, '\n')
+			}
+		case c == '/' && i+1 < len(data) && data[i+1] == '*':
+			i += 2
+			for i+1 < len(data) && !(data[i] == '*' && data[i+1] == '/') {
+				i++
+			}
+			i++
+		default:
+			out = append(out, c)
+		}
+	}
+	return out
+}
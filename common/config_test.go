@@ -0,0 +1,45 @@
+package common
+
+import (
+	"testing"
+)
+
+func TestResolveConfigFile(t *testing.T) {
+	filename, err := ResolveConfigFile("__fixtures", "repos")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if filename != "__fixtures/repos.yaml" {
+		t.Error("expected __fixtures/repos.yaml, got", filename)
+	}
+}
+
+func TestResolveConfigFileMissing(t *testing.T) {
+	if _, err := ResolveConfigFile("__fixtures", "ixnay"); err == nil {
+		t.Error("expected error, didn't get it.")
+	}
+}
+
+func TestStripJsonComments(t *testing.T) {
+	stripped := string(stripJsonComments([]byte(`{"a":"//b", /* c */ "d":"\"/*e*/"} // f`)))
+	expected := `{"a":"//b",  "d":"\"/*e*/"} `
+	if stripped != expected {
+		t.Error("expected", expected, "got", stripped)
+	}
+}
+
+func TestLoadRepositoriesYaml(t *testing.T) {
+	repos, err := LoadRepositories("__fixtures/repos.yaml", NewFacts(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count := len(*repos); count != 2 {
+		t.Fatal("expected 2, got", count)
+	}
+
+	if url := (*repos)[1].URL; url != "github.com/rjz/dos" {
+		t.Error("expected github.com/rjz/dos, got", url)
+	}
+}
@@ -5,6 +5,10 @@ import (
 	"fmt"
 )
 
+// DryRunFact is set when a session should report changes instead of making
+// them
+const DryRunFact = "hubbub.dry_run"
+
 // Facts are a write-once key:value store
 type Facts map[string]interface{}
 
@@ -23,6 +27,10 @@ func (f *Facts) GetInt(k string) int {
 	return f.Get(k).(int)
 }
 
+func (f *Facts) GetBool(k string) bool {
+	return f.Get(k).(bool)
+}
+
 func (f *Facts) Get(k string) interface{} {
 	return (*f)[k]
 }
@@ -36,12 +44,24 @@ func (f *Facts) set(k string, v interface{}) error {
 	return nil
 }
 
-// SetRepository assigns defaults for the repository
-func (f *Facts) SetRepository(r *Repository) {
+// SetRepository assigns defaults for the repository, followed by any facts
+// specified for it (which are prefixed with `repo.`)
+func (f *Facts) SetRepository(r *Repository) error {
 	f.SetString("repo.host", *r.Host())
 	f.SetString("repo.owner", *r.Owner())
 	f.SetString("repo.name", *r.Name())
 	f.SetString("repo.url", r.URL)
+
+	for k, v := range r.Facts {
+		name := fmt.Sprintf("repo.%s", k)
+		if f.IsAvailable(name) {
+			return errors.New(fmt.Sprintf("fact '%s' cannot be overridden", name))
+		}
+		if err := f.Set(name, v); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Set assigns k to the interface-type v, returning an error on failed assignment
@@ -53,6 +73,12 @@ func (f *Facts) Set(k string, v interface{}) error {
 		return f.SetInt(k, v.(int))
 	case bool:
 		return f.SetBool(k, v.(bool))
+	case float64:
+		// JSON numbers; only integers are supported
+		if n := v.(float64); n == float64(int(n)) {
+			return f.SetInt(k, int(n))
+		}
+		return errors.New(fmt.Sprintf("Invalid value for '%s' (only integers are supported)", k))
 	default:
 		return errors.New(fmt.Sprintf("Invalid type for '%s'", k))
 	}
@@ -87,3 +113,8 @@ func (f *Facts) SetBool(k string, v bool) error {
 func (f *Facts) IsAvailable(k string) bool {
 	return (*f)[k] != nil
 }
+
+// IsDryRun reports whether services should leave remote state untouched
+func (f *Facts) IsDryRun() bool {
+	return f.IsAvailable(DryRunFact) && f.GetBool(DryRunFact)
+}
@@ -0,0 +1,82 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// factReference matches a reference to a fact about the repository, e.g.
+// `{{ repo.name }}`. Other facts (including credentials like
+// `github.access_token`) can't be referenced, and other text in braces (e.g.
+// `${{ github.ref }}` in a workflow) is left alone.
+var factReference = regexp.MustCompile(`{{\s*(repo(?:\.\w+)+)\s*}}`)
+
+// interpolateString replaces fact references in s with their values
+func interpolateString(s string, f *Facts) (string, error) {
+	var err error
+	result := factReference.ReplaceAllStringFunc(s, func(ref string) string {
+		name := factReference.FindStringSubmatch(ref)[1]
+		if !f.IsAvailable(name) {
+			if err == nil {
+				err = errors.New(fmt.Sprintf("unknown fact '%s'", name))
+			}
+			return ref
+		}
+		return fmt.Sprint(f.Get(name))
+	})
+	return result, err
+}
+
+// interpolateValue replaces fact references in every string within a decoded
+// JSON value
+func interpolateValue(v interface{}, f *Facts) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		return interpolateString(v, f)
+	case map[string]interface{}:
+		for k, item := range v {
+			interpolated, err := interpolateValue(item, f)
+			if err != nil {
+				return nil, err
+			}
+			v[k] = interpolated
+		}
+		return v, nil
+	case []interface{}:
+		for i, item := range v {
+			interpolated, err := interpolateValue(item, f)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = interpolated
+		}
+		return v, nil
+	default:
+		return v, nil
+	}
+}
+
+// Interpolate returns a copy of a goal's raw configuration with references to
+// repository facts (e.g. `{{ repo.owner }}`) replaced by their values.
+// Referencing an unknown fact is an error.
+func Interpolate(raw json.RawMessage, f *Facts) (json.RawMessage, error) {
+	if !factReference.Match(raw) {
+		return raw, nil
+	}
+
+	var decoded interface{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&decoded); err != nil {
+		return nil, err
+	}
+
+	interpolated, err := interpolateValue(decoded, f)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(interpolated)
+}
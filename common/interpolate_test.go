@@ -0,0 +1,84 @@
+package common
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func interpolationFacts() *Facts {
+	return NewFacts(map[string]interface{}{
+		"repo.owner": "rjz",
+		"repo.name":  "hubbub",
+		"repo.tier":  2,
+	})
+}
+
+func TestInterpolate(t *testing.T) {
+	raw := json.RawMessage(`{
+		"content": "Copyright {{repo.owner}}",
+		"config": {"url": "https://ci.example.com/{{ repo.owner }}/{{ repo.name }}?tier={{repo.tier}}"},
+		"events": ["{{repo.name}}"],
+		"active": true,
+		"untouched": "{{ if .Ready }}{{ end }}"
+	}`)
+
+	interpolated, err := Interpolate(raw, interpolationFacts())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectJsonObject(t, interpolated, map[string]interface{}{
+		"content":   "Copyright rjz",
+		"config":    map[string]interface{}{"url": "https://ci.example.com/rjz/hubbub?tier=2"},
+		"events":    []interface{}{"hubbub"},
+		"active":    true,
+		"untouched": "{{ if .Ready }}{{ end }}",
+	})
+}
+
+func TestInterpolateUnknownFact(t *testing.T) {
+	raw := json.RawMessage(`{"content": "{{repo.team}}"}`)
+	if _, err := Interpolate(raw, interpolationFacts()); err == nil {
+		t.Error("expected error, didn't get it.")
+	}
+}
+
+func TestInterpolateVerbatim(t *testing.T) {
+	raw := json.RawMessage(`{"count": 12345678901234567890}`)
+	interpolated, err := Interpolate(raw, interpolationFacts())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(interpolated) != string(raw) {
+		t.Error("expected", string(raw), "got", string(interpolated))
+	}
+}
+
+func TestInterpolateLeavesOtherBracesAlone(t *testing.T) {
+	raw := json.RawMessage(`{"content": "ref: ${{ github.ref }}\nrepo: {{ repo.name }}"}`)
+	interpolated, err := Interpolate(raw, interpolationFacts())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectJsonObject(t, interpolated, map[string]interface{}{
+		"content": "ref: ${{ github.ref }}\nrepo: hubbub",
+	})
+}
+
+func TestInterpolateIgnoresTokenFacts(t *testing.T) {
+	f := interpolationFacts()
+	f.SetString("github.access_token", "xyz")
+	f.SetString("travis.org_token", "abc")
+
+	raw := json.RawMessage(`{"config": {"url": "https://example.com/?token={{ github.access_token }}&t={{travis.org_token}}"}}`)
+	interpolated, err := Interpolate(raw, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectJsonObject(t, interpolated, map[string]interface{}{
+		"config": map[string]interface{}{"url": "https://example.com/?token={{ github.access_token }}&t={{travis.org_token}}"},
+	})
+}
@@ -2,14 +2,42 @@ package common
 
 import (
 	"encoding/json"
-	"io/ioutil"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Reserved keys in a policy entry
+const (
+	// policyIdKey identifies a goal so that it may be overridden
+	policyIdKey = "id"
+
+	// policyIncludeKey names one or more policies to include
+	policyIncludeKey = "include"
+
+	// policyWhenKey lists conditions that must be met for a goal to apply
+	policyWhenKey = "when"
 )
 
 type PolicyGoal struct {
 	Goal       *string
+	ID         *string
+	When       []Condition
 	RawMessage json.RawMessage
 }
 
+// Unmet returns the first of the goal's conditions that the facts don't
+// satisfy, or nil if the goal applies
+func (pg *PolicyGoal) Unmet(f *Facts) *Condition {
+	for i, c := range pg.When {
+		if !c.Eval(f) {
+			return &pg.When[i]
+		}
+	}
+	return nil
+}
+
 type Policy []PolicyGoal
 
 // Goals lists all goals included in the policy
@@ -21,27 +49,167 @@ func (p Policy) Goals() []string {
 	return goals
 }
 
-// LoadPolicy reads a raw (JSON) policy from filename
-func LoadPolicy(filename string) (policy Policy, err error) {
-	data, err := ioutil.ReadFile(filename)
+// indexOf finds the goal with the given ID, returning -1 if there isn't one
+func (p Policy) indexOf(id string) int {
+	for i, pg := range p {
+		if pg.ID != nil && *pg.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// Merge appends the goals in other to the policy. A goal sharing its ID with
+// an existing goal replaces the existing goal in its original position.
+func (p Policy) Merge(other Policy) Policy {
+	merged := append(Policy{}, p...)
+	for _, pg := range other {
+		if pg.ID != nil {
+			if i := merged.indexOf(*pg.ID); i >= 0 {
+				merged[i] = pg
+				continue
+			}
+		}
+		merged = append(merged, pg)
+	}
+	return merged
+}
+
+// parsePolicyGoal reads a single goal from a policy entry
+func parsePolicyGoal(entry map[string]json.RawMessage) (*PolicyGoal, error) {
+	pg := PolicyGoal{}
+	for k, v := range entry {
+		if k == policyIdKey {
+			if err := json.Unmarshal(v, &pg.ID); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if k == policyWhenKey {
+			conditions, err := parseConditions(v)
+			if err != nil {
+				return nil, err
+			}
+			pg.When = conditions
+			continue
+		}
+
+		if pg.Goal != nil {
+			return nil, errors.New(fmt.Sprintf("entry describes multiple goals ('%s', '%s')", *pg.Goal, k))
+		}
+
+		goal := k
+		pg.Goal = &goal
+		pg.RawMessage = v
+	}
+
+	if pg.Goal == nil {
+		return nil, errors.New("entry doesn't describe a goal")
+	}
+	return &pg, nil
+}
+
+// parseIncludes reads the policy names from an include entry, which may be a
+// single name or a list of them
+func parseIncludes(raw json.RawMessage) ([]string, error) {
+	var name string
+	if err := json.Unmarshal(raw, &name); err == nil {
+		return []string{name}, nil
+	}
+
+	var names []string
+	if err := json.Unmarshal(raw, &names); err != nil {
+		return nil, errors.New("include must name a policy or a list of policies")
+	}
+	return names, nil
+}
+
+// LoadPolicy reads a raw policy from filename. Policies may be written in
+// JSON (with comments) or YAML.
+//
+// Policies may include other policies (found in the same directory) by name:
+// included goals take the place of the include entry, and a goal with an `id`
+// replaces an earlier goal with the same `id`.
+func LoadPolicy(filename string) (Policy, error) {
+	return loadPolicy(filename, nil)
+}
+
+// loadPolicy reads the policy in filename, given the stack of files that
+// included it
+func loadPolicy(filename string, includedBy []string) (Policy, error) {
+	absFilename, err := filepath.Abs(filename)
 	if err != nil {
 		return nil, err
 	}
 
+	for _, f := range includedBy {
+		if f == absFilename {
+			cycle := append(includedBy, absFilename)
+			return nil, errors.New(fmt.Sprintf("policy includes itself: %s", strings.Join(cycle, " -> ")))
+		}
+	}
+	includedBy = append(includedBy, absFilename)
+
+	data, err := readConfig(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return parsePolicy(data, func(name string) (Policy, error) {
+		includedFile, err := ResolveConfigFile(filepath.Dir(filename), name)
+		if err != nil {
+			return nil, err
+		}
+		return loadPolicy(includedFile, includedBy)
+	})
+}
+
+// parsePolicy reads a policy from JSON data, using include to load any
+// included policies
+func parsePolicy(data []byte, include func(string) (Policy, error)) (policy Policy, err error) {
 	var parsed []map[string]json.RawMessage
 	if err := json.Unmarshal(data, &parsed); err != nil {
 		return nil, err
 	}
 
 	for _, s := range parsed {
-		pg := PolicyGoal{}
-		for k, v := range s {
-			pg.RawMessage = v
-			pg.Goal = &k
-			break
+		if raw, ok := s[policyIncludeKey]; ok {
+			if include == nil {
+				return nil, errors.New("policies can't be included here")
+			}
+
+			names, err := parseIncludes(raw)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, name := range names {
+				included, err := include(name)
+				if err != nil {
+					return nil, err
+				}
+				policy = policy.Merge(included)
+			}
+			continue
 		}
 
-		policy = append(policy, pg)
+		pg, err := parsePolicyGoal(s)
+		if err != nil {
+			return nil, err
+		}
+		policy = policy.Merge(Policy{*pg})
 	}
 	return
 }
+
+// UnmarshalJSON reads a policy embedded in another document. Embedded
+// policies may not include other policies.
+func (p *Policy) UnmarshalJSON(data []byte) error {
+	policy, err := parsePolicy(data, nil)
+	if err != nil {
+		return err
+	}
+	*p = policy
+	return nil
+}
@@ -7,12 +7,11 @@ import (
 )
 
 func setup() {
-	serviceFactories.Register([]string{"foo_do", "foo_echo", "foo_invalid"}, FooServiceFactory)
+	serviceFactories.Register(append(FooGoals, GoalDefinition{Name: "foo_invalid"}), FooServiceFactory)
 }
 
 func teardown() {
-	serviceFactories = ServiceFactoryRegistry{}
-	serviceFactories.goals = make(map[string]*int)
+	serviceFactories = *NewServiceFactoryRegistry()
 }
 
 func expectJsonObject(t *testing.T, msg json.RawMessage, expected map[string]interface{}) {
@@ -37,12 +36,24 @@ func expectGoal(t *testing.T, pg PolicyGoal, goal string, body map[string]interf
 }
 
 func TestLoadPolicy(t *testing.T) {
+	expectTestPolicy(t, "__fixtures/test.json")
+}
+
+func TestLoadPolicyJsonComments(t *testing.T) {
+	expectTestPolicy(t, "__fixtures/test_comments.json")
+}
+
+func TestLoadPolicyYaml(t *testing.T) {
+	expectTestPolicy(t, "__fixtures/test.yaml")
+}
+
+func expectTestPolicy(t *testing.T, filename string) {
 	setup()
 	defer teardown()
 
-	fixture, err := LoadPolicy("__fixtures/test.json")
+	fixture, err := LoadPolicy(filename)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
 
 	count := len(fixture)
@@ -71,3 +82,57 @@ func TestPolicyGoals(t *testing.T) {
 		t.Error("expected", expected, "got", p.Goals())
 	}
 }
+
+func TestLoadPolicyIncludes(t *testing.T) {
+	policy, err := LoadPolicy("__fixtures/layered.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"foo_echo", "foo_do", "foo_echo"}
+	if !reflect.DeepEqual(policy.Goals(), expected) {
+		t.Fatal("expected", expected, "got", policy.Goals())
+	}
+
+	expectGoal(t, policy[1], "foo_do", map[string]interface{}{
+		"bar":      "baz",
+		"greeting": "howdy",
+	})
+}
+
+func TestLoadPolicyIncludeCycle(t *testing.T) {
+	if _, err := LoadPolicy("__fixtures/cycle_a.json"); err == nil {
+		t.Error("expected error, didn't get it.")
+	}
+}
+
+func TestPolicyMerge(t *testing.T) {
+	base := Policy{
+		PolicyGoal{Goal: String("goal_one"), ID: String("one")},
+		PolicyGoal{Goal: String("goal_two")},
+	}
+
+	merged := base.Merge(Policy{
+		PolicyGoal{Goal: String("goal_three"), ID: String("one")},
+		PolicyGoal{Goal: String("goal_two")},
+	})
+
+	expected := []string{"goal_three", "goal_two", "goal_two"}
+	if !reflect.DeepEqual(merged.Goals(), expected) {
+		t.Error("expected", expected, "got", merged.Goals())
+	}
+
+	if *base[0].Goal != "goal_one" {
+		t.Error("expected merge to leave base policy intact")
+	}
+}
+
+func TestParsePolicyGoalMultipleGoals(t *testing.T) {
+	entry := map[string]json.RawMessage{
+		"goal_one": json.RawMessage(`{}`),
+		"goal_two": json.RawMessage(`{}`),
+	}
+	if _, err := parsePolicyGoal(entry); err == nil {
+		t.Error("expected error, didn't get it.")
+	}
+}
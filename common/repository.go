@@ -2,12 +2,21 @@ package common
 
 import (
 	"encoding/json"
-	"io/ioutil"
+	"errors"
+	"fmt"
 	"strings"
 )
 
 type Repository struct {
-	URL       string `json:"url,omitempty"`
+	URL string `json:"url,omitempty"`
+
+	// Facts describe the repository to policies (e.g. `team` is available to
+	// goals as `repo.team`)
+	Facts map[string]interface{} `json:"facts,omitempty"`
+
+	// Overrides are merged into the policy applied to the repository
+	Overrides Policy `json:"overrides,omitempty"`
+
 	urlPieces []string
 }
 
@@ -30,16 +39,88 @@ func (r *Repository) Name() *string {
 	return r.urlFragment(2)
 }
 
-func LoadRepositories(filename string) (*[]Repository, error) {
-	data, err := ioutil.ReadFile(filename)
+// RepositorySource expands a repository list entry (e.g. naming a github
+// organization) into the repositories it describes, using facts (e.g. access
+// tokens) as needed
+type RepositorySource func(entry *json.RawMessage, facts *Facts) ([]Repository, error)
+
+var repositorySources = map[string]RepositorySource{}
+
+// RegisterRepositorySource associates a key in repository list entries with
+// the source that expands them
+func RegisterRepositorySource(key string, source RepositorySource) {
+	if repositorySources[key] != nil {
+		panic(fmt.Sprintf("repository source '%s' was previously defined", key))
+	}
+	repositorySources[key] = source
+}
+
+// expandEntry reads a single entry from a repository list
+func expandEntry(entry json.RawMessage, facts *Facts) ([]Repository, error) {
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(entry, &keys); err != nil {
+		return nil, err
+	}
+
+	r := Repository{}
+	if err := json.Unmarshal(entry, &r); err != nil {
+		return nil, err
+	}
+
+	if r.URL != "" {
+		return []Repository{r}, nil
+	}
+
+	for key := range keys {
+		source := repositorySources[key]
+		if source == nil {
+			continue
+		}
+
+		expanded, err := source(&entry, facts)
+		if err != nil {
+			return nil, err
+		}
+
+		// facts and overrides apply to every repository from the source
+		for i := range expanded {
+			if expanded[i].Facts == nil {
+				expanded[i].Facts = r.Facts
+			}
+			if expanded[i].Overrides == nil {
+				expanded[i].Overrides = r.Overrides
+			}
+		}
+		return expanded, nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("repository entry has no url or known source: %s", string(entry)))
+}
+
+// LoadRepositories reads a list of repositories from filename. Lists may be
+// written in JSON (with comments) or YAML.
+//
+// Entries may specify a repository `url`, or describe a source of
+// repositories (such as a github organization) that's expanded using facts.
+func LoadRepositories(filename string, facts *Facts) (*[]Repository, error) {
+	data, err := readConfig(filename)
 	if err != nil {
 		return nil, err
 	}
 
-	rs := []Repository{}
-	if err := json.Unmarshal(data, &rs); err != nil {
+	var entries []json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
 		return nil, err
 	}
 
+	rs := []Repository{}
+	for _, entry := range entries {
+		expanded, err := expandEntry(entry, facts)
+		if err != nil {
+			return nil, err
+		}
+		rs = append(rs, expanded...)
+	}
+
 	return &rs, nil
 }
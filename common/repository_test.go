@@ -0,0 +1,104 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestRepositoryUrlPieces(t *testing.T) {
+	r := Repository{URL: "github.com/rjz/hubbub"}
+	if *r.Host() != "github.com" || *r.Owner() != "rjz" || *r.Name() != "hubbub" {
+		t.Error("unexpected url pieces", *r.Host(), *r.Owner(), *r.Name())
+	}
+}
+
+func TestLoadRepositoriesFactsAndOverrides(t *testing.T) {
+	repos, err := LoadRepositories("__fixtures/repos_overrides.json", NewFacts(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := (*repos)[0]
+	facts := NewFacts(nil)
+	if err := facts.SetRepository(&repo); err != nil {
+		t.Fatal(err)
+	}
+
+	if team := facts.GetString("repo.team"); team != "platform" {
+		t.Error("expected platform, got", team)
+	}
+
+	if tier := facts.GetInt("repo.tier"); tier != 1 {
+		t.Error("expected 1, got", tier)
+	}
+
+	if !facts.GetBool("repo.public") {
+		t.Error("expected repo.public to be set")
+	}
+
+	base, err := LoadPolicy("__fixtures/base.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := base.Merge(repo.Overrides)
+	if count := len(policy); count != 2 {
+		t.Fatal("expected 2, got", count)
+	}
+
+	expectGoal(t, policy[0], "foo_do", map[string]interface{}{
+		"bar":      "baz",
+		"greeting": "ahoy",
+	})
+}
+
+func TestSetRepositoryReservedFact(t *testing.T) {
+	repo := Repository{
+		URL:   "github.com/rjz/hubbub",
+		Facts: map[string]interface{}{"owner": "someone-else"},
+	}
+
+	if err := NewFacts(nil).SetRepository(&repo); err == nil {
+		t.Error("expected error, didn't get it.")
+	}
+}
+
+func TestLoadRepositoriesSource(t *testing.T) {
+	RegisterRepositorySource("test_org", func(entry *json.RawMessage, facts *Facts) ([]Repository, error) {
+		params := struct {
+			Org   string `json:"test_org"`
+			Count int    `json:"count"`
+		}{}
+		if err := json.Unmarshal(*entry, &params); err != nil {
+			return nil, err
+		}
+
+		var rs []Repository
+		for i := 0; i < params.Count; i++ {
+			rs = append(rs, Repository{URL: fmt.Sprintf("github.com/%s/repo-%d", params.Org, i)})
+		}
+		return rs, nil
+	})
+	defer delete(repositorySources, "test_org")
+
+	repos, err := LoadRepositories("__fixtures/repos_source.json", NewFacts(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count := len(*repos); count != 3 {
+		t.Fatal("expected 3, got", count)
+	}
+
+	expanded := (*repos)[2]
+	if expanded.URL != "github.com/rjz/repo-1" || expanded.Facts["team"] != "platform" {
+		t.Error("unexpected repository", expanded)
+	}
+}
+
+func TestLoadRepositoriesUnknownSource(t *testing.T) {
+	if _, err := LoadRepositories("__fixtures/repos_source.json", NewFacts(nil)); err == nil {
+		t.Error("expected error, didn't get it.")
+	}
+}
@@ -0,0 +1,123 @@
+package common
+
+import (
+	"math/rand"
+	"net"
+	"net/http"
+	"reflect"
+	"time"
+)
+
+// Facts used to configure retries
+const (
+	RetryAttemptsFact = "hubbub.retry_attempts"
+	RetryBackoffFact  = "hubbub.retry_backoff_ms"
+	RetryJitterFact   = "hubbub.retry_jitter_pct"
+)
+
+// maxRetryBackoffExp caps the growth of retry delays (at 64x the backoff)
+const maxRetryBackoffExp = 6
+
+// RetryPolicy describes how requests that fail for transient reasons are
+// retried
+type RetryPolicy struct {
+	// Attempts is the maximum number of times a request is tried
+	Attempts int
+
+	// Backoff is the delay before the first retry; it doubles with each
+	// subsequent attempt
+	Backoff time.Duration
+
+	// Jitter randomly varies each delay by up to this fraction of its length
+	Jitter float64
+
+	sleep  func(time.Duration)
+	random func() float64
+}
+
+// DefaultRetryPolicy is used when no retry facts are available
+var DefaultRetryPolicy = RetryPolicy{Attempts: 3, Backoff: 500 * time.Millisecond, Jitter: 0.2}
+
+// NewRetryPolicy configures a RetryPolicy from the retry facts, falling back
+// to the DefaultRetryPolicy for any that aren't set
+func NewRetryPolicy(f *Facts) *RetryPolicy {
+	p := DefaultRetryPolicy
+	if f.IsAvailable(RetryAttemptsFact) {
+		p.Attempts = f.GetInt(RetryAttemptsFact)
+	}
+	if f.IsAvailable(RetryBackoffFact) {
+		p.Backoff = time.Duration(f.GetInt(RetryBackoffFact)) * time.Millisecond
+	}
+	if f.IsAvailable(RetryJitterFact) {
+		p.Jitter = float64(f.GetInt(RetryJitterFact)) / 100
+	}
+	return &p
+}
+
+// Delay returns how long to wait before retrying after the nth (1-indexed)
+// failed attempt
+func (p *RetryPolicy) Delay(attempt int) time.Duration {
+	exp := attempt - 1
+	if exp > maxRetryBackoffExp {
+		exp = maxRetryBackoffExp
+	}
+
+	delay := float64(p.Backoff * time.Duration(1<<uint(exp)))
+	random := rand.Float64
+	if p.random != nil {
+		random = p.random
+	}
+	delay += delay * p.Jitter * (2*random() - 1)
+	return time.Duration(delay)
+}
+
+// Wait sleeps for the delay following the nth failed attempt
+func (p *RetryPolicy) Wait(attempt int) {
+	sleep := time.Sleep
+	if p.sleep != nil {
+		sleep = p.sleep
+	}
+	sleep(p.Delay(attempt))
+}
+
+// Do calls fn until it succeeds, it fails with an error that isRetryable
+// rejects, or the policy's attempts are exhausted. The last error is returned.
+func (p *RetryPolicy) Do(isRetryable func(error) bool, fn func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil || attempt >= p.Attempts || !isRetryable(err) {
+			return err
+		}
+		p.Wait(attempt)
+	}
+}
+
+// RetryableStatus reports whether an HTTP status indicates a transient failure
+func RetryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+// RetryableError reports whether err indicates a transient failure: either a
+// network error or an API error (in the style of go-github's ErrorResponse)
+// carrying a retryable HTTP response.
+func RetryableError(err error) bool {
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+
+	v := reflect.ValueOf(err)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return false
+	}
+
+	field := v.FieldByName("Response")
+	if !field.IsValid() {
+		return false
+	}
+
+	resp, ok := field.Interface().(*http.Response)
+	return ok && resp != nil && RetryableStatus(resp.StatusCode)
+}
@@ -0,0 +1,124 @@
+package common
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+type apiError struct {
+	Response *http.Response
+}
+
+func (e *apiError) Error() string {
+	return "api error"
+}
+
+func retryPolicyFixture(slept *[]time.Duration) *RetryPolicy {
+	p := RetryPolicy{Attempts: 3, Backoff: time.Second, Jitter: 0.5}
+	p.random = func() float64 { return 0.5 }
+	p.sleep = func(d time.Duration) { *slept = append(*slept, d) }
+	return &p
+}
+
+func alwaysRetry(error) bool {
+	return true
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{Backoff: time.Second}
+	for attempt, expected := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second} {
+		if delay := p.Delay(attempt); delay != expected {
+			t.Error("expected", expected, "got", delay)
+		}
+	}
+}
+
+func TestRetryPolicyDelayJitter(t *testing.T) {
+	p := RetryPolicy{Backoff: time.Second, Jitter: 0.5}
+	p.random = func() float64 { return 1 }
+	if delay := p.Delay(1); delay != 1500*time.Millisecond {
+		t.Error("expected 1.5s, got", delay)
+	}
+}
+
+func TestRetryPolicyDoSucceeds(t *testing.T) {
+	var slept []time.Duration
+	calls := 0
+	err := retryPolicyFixture(&slept).Do(alwaysRetry, func() error {
+		calls++
+		if calls < 2 {
+			return errors.New("flaky")
+		}
+		return nil
+	})
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	if calls != 2 || len(slept) != 1 {
+		t.Error("expected 2 calls and 1 pause, got", calls, slept)
+	}
+}
+
+func TestRetryPolicyDoGivesUp(t *testing.T) {
+	var slept []time.Duration
+	calls := 0
+	err := retryPolicyFixture(&slept).Do(alwaysRetry, func() error {
+		calls++
+		return errors.New("broken")
+	})
+
+	if err == nil {
+		t.Error("expected error, didn't get it.")
+	}
+
+	if calls != 3 {
+		t.Error("expected 3, got", calls)
+	}
+}
+
+func TestRetryPolicyDoPermanentError(t *testing.T) {
+	var slept []time.Duration
+	calls := 0
+	retryPolicyFixture(&slept).Do(RetryableError, func() error {
+		calls++
+		return errors.New("permanent")
+	})
+
+	if calls != 1 {
+		t.Error("expected 1, got", calls)
+	}
+}
+
+func TestNewRetryPolicyFromFacts(t *testing.T) {
+	f := NewFacts(map[string]interface{}{
+		RetryAttemptsFact: 5,
+		RetryBackoffFact:  100,
+	})
+
+	p := NewRetryPolicy(f)
+	if p.Attempts != 5 || p.Backoff != 100*time.Millisecond || p.Jitter != DefaultRetryPolicy.Jitter {
+		t.Error("unexpected policy", p)
+	}
+}
+
+func TestRetryableError(t *testing.T) {
+	cases := map[error]bool{
+		errors.New("nope"): false,
+		&url.Error{Op: "Get", URL: "x", Err: errors.New("x")}: true,
+		&apiError{&http.Response{StatusCode: 502}}:            true,
+		&apiError{&http.Response{StatusCode: 429}}:            true,
+		&apiError{&http.Response{StatusCode: 404}}:            false,
+		&apiError{}: false,
+	}
+
+	for err, expected := range cases {
+		if RetryableError(err) != expected {
+			t.Error("expected", expected, "for", err)
+		}
+	}
+}
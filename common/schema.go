@@ -0,0 +1,197 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Schema describes the parameters a goal accepts. It borrows its vocabulary
+// from JSON Schema, supporting just enough of it to catch mistakes in a policy
+// before any goal is applied.
+type Schema struct {
+	// Description explains the value in prose
+	Description string `json:"description,omitempty"`
+
+	// Type is one of "object", "array", "string", "boolean", "integer" or
+	// "number". Any type is accepted if it is empty.
+	Type string `json:"type,omitempty"`
+
+	// Enum lists the only values allowed
+	Enum []interface{} `json:"enum,omitempty"`
+
+	// Properties describe the members of an object
+	Properties map[string]*Schema `json:"properties,omitempty"`
+
+	// Required lists the members an object must include
+	Required []string `json:"required,omitempty"`
+
+	// AdditionalProperties, if false, rejects members not listed in Properties
+	AdditionalProperties *bool `json:"additionalProperties,omitempty"`
+
+	// Items describes each element of an array
+	Items *Schema `json:"items,omitempty"`
+
+	// OneOf lists alternative schemas, exactly one of which must match
+	OneOf []*Schema `json:"oneOf,omitempty"`
+}
+
+// ValidationError lists the problems found while validating a value
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return strings.Join(e, "; ")
+}
+
+// Validate checks a raw JSON value against the schema
+func (s *Schema) Validate(raw json.RawMessage) error {
+	var decoded interface{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&decoded); err != nil {
+		return err
+	}
+
+	if problems := s.validate("", decoded); len(problems) > 0 {
+		return ValidationError(problems)
+	}
+	return nil
+}
+
+// describe names the value at path in a problem report
+func describe(path string) string {
+	if path == "" {
+		return "value"
+	}
+	return path
+}
+
+// member extends path with an object member or array index
+func member(path string, key interface{}) string {
+	if i, ok := key.(int); ok {
+		return fmt.Sprintf("%s[%d]", path, i)
+	}
+	if path == "" {
+		return fmt.Sprint(key)
+	}
+	return fmt.Sprintf("%s.%s", path, key)
+}
+
+// typeOf names the JSON type of a decoded value
+func typeOf(v interface{}) string {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	default:
+		return "null"
+	}
+}
+
+// hasType reports whether a decoded value is of the named JSON type
+func hasType(v interface{}, t string) bool {
+	actual := typeOf(v)
+	return actual == t || (t == "number" && actual == "integer")
+}
+
+// validate lists the problems with the decoded value at path
+func (s *Schema) validate(path string, v interface{}) []string {
+	if s.Type != "" && !hasType(v, s.Type) {
+		return []string{fmt.Sprintf("%s must be of type %s (got %s)", describe(path), s.Type, typeOf(v))}
+	}
+
+	var problems []string
+	if len(s.Enum) > 0 && !s.allows(v) {
+		var allowed []string
+		for _, e := range s.Enum {
+			allowed = append(allowed, fmt.Sprintf("%#v", e))
+		}
+		problems = append(problems, fmt.Sprintf("%s must be one of %s", describe(path), strings.Join(allowed, ", ")))
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		problems = append(problems, s.validateObject(path, v)...)
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range v {
+				problems = append(problems, s.Items.validate(member(path, i), item)...)
+			}
+		}
+	}
+
+	if len(s.OneOf) > 0 {
+		problems = append(problems, s.validateOneOf(path, v)...)
+	}
+	return problems
+}
+
+// allows reports whether v is listed in the schema's Enum
+func (s *Schema) allows(v interface{}) bool {
+	for _, e := range s.Enum {
+		if fmt.Sprint(e) == fmt.Sprint(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateObject checks required and described members of an object
+func (s *Schema) validateObject(path string, obj map[string]interface{}) []string {
+	var problems []string
+	for _, key := range s.Required {
+		if _, ok := obj[key]; !ok {
+			problems = append(problems, fmt.Sprintf("%s is required", member(path, key)))
+		}
+	}
+
+	var keys []string
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if prop, ok := s.Properties[key]; ok {
+			problems = append(problems, prop.validate(member(path, key), obj[key])...)
+		} else if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+			problems = append(problems, fmt.Sprintf("%s is not allowed", member(path, key)))
+		}
+	}
+	return problems
+}
+
+// validateOneOf checks that exactly one alternative describes v
+func (s *Schema) validateOneOf(path string, v interface{}) []string {
+	var alternatives, matched []string
+	for i, alt := range s.OneOf {
+		if problems := alt.validate(path, v); len(problems) > 0 {
+			alternatives = append(alternatives, strings.Join(problems, " and "))
+		} else if alt.Description != "" {
+			matched = append(matched, alt.Description)
+		} else {
+			matched = append(matched, fmt.Sprintf("alternative %d", i+1))
+		}
+	}
+
+	switch len(matched) {
+	case 1:
+		return nil
+	case 0:
+		return []string{fmt.Sprintf("%s must satisfy one of: %s", describe(path), strings.Join(alternatives, ", or "))}
+	default:
+		return []string{fmt.Sprintf("%s is ambiguous (could be %s)", describe(path), strings.Join(matched, " or "))}
+	}
+}
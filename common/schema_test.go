@@ -0,0 +1,61 @@
+package common
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+var fileSchemaFixture = &Schema{
+	Type:     "object",
+	Required: []string{"state", "name"},
+	Properties: map[string]*Schema{
+		"state":   {Type: "string", Enum: []interface{}{"present", "absent"}},
+		"name":    {Type: "string"},
+		"content": {Type: "string"},
+		"mode":    {Type: "integer"},
+		"tags":    {Type: "array", Items: &Schema{Type: "string"}},
+	},
+	AdditionalProperties: Bool(false),
+	OneOf: []*Schema{
+		{Description: "an absent file", Properties: map[string]*Schema{"state": {Enum: []interface{}{"absent"}}}},
+		{Description: "a file with content", Required: []string{"content"}},
+	},
+}
+
+func expectValidationError(t *testing.T, raw, expected string) {
+	err := fileSchemaFixture.Validate(json.RawMessage(raw))
+	if err == nil {
+		t.Error("expected error for", raw, "didn't get it.")
+		return
+	}
+
+	if !strings.Contains(err.Error(), expected) {
+		t.Errorf("expected '%s' to mention '%s'", err, expected)
+	}
+}
+
+func TestSchemaValidate(t *testing.T) {
+	for _, raw := range []string{
+		`{"state":"absent","name":"foo"}`,
+		`{"state":"present","name":"foo","content":"bar","mode":644,"tags":["a","b"]}`,
+	} {
+		if err := fileSchemaFixture.Validate(json.RawMessage(raw)); err != nil {
+			t.Error("expected", raw, "to be valid, got", err)
+		}
+	}
+}
+
+func TestSchemaValidateProblems(t *testing.T) {
+	expectValidationError(t, `[]`, "value must be of type object (got array)")
+	expectValidationError(t, `{"state":"present"}`, "name is required")
+	expectValidationError(t, `{"state":"presnet","name":"foo","content":"bar"}`, `state must be one of "present", "absent"`)
+	expectValidationError(t, `{"state":"absent","name":"foo","mode":6.44}`, "mode must be of type integer (got number)")
+	expectValidationError(t, `{"state":"absent","name":"foo","tags":["a",1]}`, "tags[1] must be of type string")
+	expectValidationError(t, `{"state":"absent","name":"foo","nmae":"foo"}`, "nmae is not allowed")
+	expectValidationError(t, `{"state":"present","name":"foo"}`, "content is required")
+}
+
+func TestSchemaValidateAmbiguous(t *testing.T) {
+	expectValidationError(t, `{"state":"absent","name":"foo","content":"bar"}`, "could be an absent file or a file with content")
+}
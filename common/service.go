@@ -4,14 +4,22 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
 )
 
 // Service represents a hubbub service implementation
 type Service interface {
 
 	// Do applies a single policy goal using a string (the goal name) and a raw,
-	// JSON configuration, returning an error if the goal cannot be achieved.
-	Do(string, *json.RawMessage) error
+	// JSON configuration. It returns a record of each resource the goal
+	// touched, or an error if the goal cannot be achieved.
+	Do(string, *json.RawMessage) ([]Change, error)
+}
+
+// Flusher is implemented by services that defer some of their work (e.g.
+// batching changes) until every goal has been applied
+type Flusher interface {
+	Flush() error
 }
 
 // ServiceRegistry organizes Service implementations by goal name
@@ -21,32 +29,109 @@ type ServiceRegistry map[string]*Service
 // specified Facts
 type ServiceFactory func(*Facts) (*Service, error)
 
+// GoalDefinition describes a goal provided by a service
+type GoalDefinition struct {
+	Name string
+
+	// Description summarizes what the goal manages
+	Description string
+
+	// Schema describes the goal's parameters. Goals without a schema accept
+	// any parameters.
+	Schema *Schema
+
+	// Example is a sample (JSON) configuration for the goal
+	Example string
+}
+
+// Validate checks a goal's raw configuration against its schema
+func (d *GoalDefinition) Validate(raw json.RawMessage) error {
+	if d.Schema == nil {
+		return nil
+	}
+	return d.Schema.Validate(raw)
+}
+
 // ServiceFactoryRegistry enumerates goals by the services that implement them
 type ServiceFactoryRegistry struct {
-	goals     map[string]*int
-	factories []ServiceFactory
+	goals       map[string]*int
+	definitions map[string]GoalDefinition
+	factories   []ServiceFactory
 }
 
 // NewServiceFactoryRegistry initializes an empty registry
 func NewServiceFactoryRegistry() *ServiceFactoryRegistry {
 	return &ServiceFactoryRegistry{
-		goals: make(map[string]*int),
+		goals:       make(map[string]*int),
+		definitions: make(map[string]GoalDefinition),
 	}
 }
 
-// Register associates `goals` with the provided `factory`
-func (r *ServiceFactoryRegistry) Register(goals []string, factory ServiceFactory) {
+// Register associates the goals described by `definitions` with the provided
+// `factory`
+func (r *ServiceFactoryRegistry) Register(definitions []GoalDefinition, factory ServiceFactory) {
 	// add factory
 	factoryIndex := len(r.factories)
 	r.factories = append(r.factories, factory)
 
 	// point goals to new factory
-	for _, goal := range goals {
-		if r.goals[goal] != nil {
-			panic(fmt.Sprintf("goal '%s' was previously defined", goal))
+	for _, d := range definitions {
+		if r.goals[d.Name] != nil {
+			panic(fmt.Sprintf("goal '%s' was previously defined", d.Name))
+		}
+		r.goals[d.Name] = &factoryIndex
+		r.definitions[d.Name] = d
+	}
+}
+
+// Definitions lists the definitions of all registered goals, sorted by name
+func (r *ServiceFactoryRegistry) Definitions() []GoalDefinition {
+	var definitions []GoalDefinition
+	for _, goal := range r.Goals() {
+		definitions = append(definitions, r.definitions[goal])
+	}
+	sort.Sort(byGoalName(definitions))
+	return definitions
+}
+
+type byGoalName []GoalDefinition
+
+func (a byGoalName) Len() int           { return len(a) }
+func (a byGoalName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byGoalName) Less(i, j int) bool { return a[i].Name < a[j].Name }
+
+// Definition returns the definition of a registered goal
+func (r *ServiceFactoryRegistry) Definition(goal string) (*GoalDefinition, error) {
+	d, ok := r.definitions[goal]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("no service available for '%s'", goal))
+	}
+	return &d, nil
+}
+
+// ValidateGoal checks a goal's raw configuration against the schema supplied
+// by its service
+func (r *ServiceFactoryRegistry) ValidateGoal(goal string, raw json.RawMessage) error {
+	d, err := r.Definition(goal)
+	if err != nil {
+		return err
+	}
+	if err := d.Validate(raw); err != nil {
+		return errors.New(fmt.Sprintf("%s: %s", goal, err))
+	}
+	return nil
+}
+
+// Validate checks every goal in a policy, returning one error for each goal
+// that is unavailable or misconfigured
+func (r *ServiceFactoryRegistry) Validate(p Policy) []error {
+	var errs []error
+	for _, pg := range p {
+		if err := r.ValidateGoal(*pg.Goal, pg.RawMessage); err != nil {
+			errs = append(errs, err)
 		}
-		r.goals[goal] = &factoryIndex
 	}
+	return errs
 }
 
 func (r *ServiceFactoryRegistry) factoryId(name string) int {
@@ -77,19 +162,21 @@ func (r *ServiceFactoryRegistry) goalsByFactoryId(factoryId int) []string {
 }
 
 // CreateServices constructs a `ServiceRegistry` containing service
-// instances for the requested goals.
+// instances for the requested goals. If a service can't be created, the
+// services created before it are returned alongside the error so that they
+// can be closed.
 func (r *ServiceFactoryRegistry) CreateServices(goals []string, facts *Facts) (*ServiceRegistry, error) {
 	services := ServiceRegistry{}
 	for _, goal := range goals {
 		if r.goals[goal] == nil {
-			return nil, errors.New(fmt.Sprintf("no service available for '%s'", goal))
+			return &services, errors.New(fmt.Sprintf("no service available for '%s'", goal))
 		}
 
 		if services[goal] == nil {
 			factoryIndex := r.factoryId(goal)
 			svc, err := r.createService(factoryIndex, facts)
 			if err != nil {
-				return nil, err
+				return &services, err
 			}
 
 			for _, alias := range r.goalsByFactoryId(factoryIndex) {
@@ -104,7 +191,7 @@ func (r *ServiceFactoryRegistry) CreateServices(goals []string, facts *Facts) (*
 var serviceFactories ServiceFactoryRegistry
 
 // RegisterService adds a factory to the global registry for the specified goals
-func RegisterService(goals []string, factory ServiceFactory) {
+func RegisterService(goals []GoalDefinition, factory ServiceFactory) {
 	serviceFactories.Register(goals, factory)
 }
 
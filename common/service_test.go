@@ -1,13 +1,14 @@
 package common
 
 import (
+	"encoding/json"
 	"errors"
 	"testing"
 )
 
 func TestPolicyCreateServicesUnavailableGoal(t *testing.T) {
 	r := NewServiceFactoryRegistry()
-	r.Register([]string{"foo_do", "foo_echo"}, FooServiceFactory)
+	r.Register(FooGoals, FooServiceFactory)
 	if _, err := r.CreateServices([]string{"ixnay"}, &Facts{}); err == nil {
 		t.Error("expected error for invalid service; didn't get it.")
 	}
@@ -15,7 +16,7 @@ func TestPolicyCreateServicesUnavailableGoal(t *testing.T) {
 
 func TestPolicyCreateServicesInstanceFails(t *testing.T) {
 	r := NewServiceFactoryRegistry()
-	r.Register([]string{"broken_task"}, func(pc *Facts) (*Service, error) {
+	r.Register([]GoalDefinition{{Name: "broken_task"}}, func(pc *Facts) (*Service, error) {
 		return nil, errors.New("service failed to start")
 	})
 
@@ -26,7 +27,7 @@ func TestPolicyCreateServicesInstanceFails(t *testing.T) {
 
 func TestPolicyCreateServicesSetAllServiceGoals(t *testing.T) {
 	r := NewServiceFactoryRegistry()
-	r.Register([]string{"foo_do", "foo_echo"}, FooServiceFactory)
+	r.Register(FooGoals, FooServiceFactory)
 
 	services, _ := r.CreateServices([]string{"foo_do"}, &Facts{})
 	if (*services)["foo_do"] == nil || (*services)["foo_echo"] == nil {
@@ -36,10 +37,40 @@ func TestPolicyCreateServicesSetAllServiceGoals(t *testing.T) {
 
 func TestPolicyCreateServicesShareInstance(t *testing.T) {
 	r := NewServiceFactoryRegistry()
-	r.Register([]string{"foo_do", "foo_echo"}, FooServiceFactory)
+	r.Register(FooGoals, FooServiceFactory)
 
 	services, _ := r.CreateServices([]string{"foo_do", "foo_echo"}, &Facts{})
 	if (*services)["foo_do"] != (*services)["foo_echo"] {
 		t.Error("expected all foo_* goals to share single service instance; they didn't.")
 	}
 }
+
+func TestServiceFactoryRegistryValidate(t *testing.T) {
+	r := NewServiceFactoryRegistry()
+	r.Register(FooGoals, FooServiceFactory)
+
+	errs := r.Validate(Policy{
+		PolicyGoal{Goal: String("foo_do"), RawMessage: json.RawMessage(`{"bar":"baz"}`)},
+		PolicyGoal{Goal: String("foo_do"), RawMessage: json.RawMessage(`{"bar":1}`)},
+		PolicyGoal{Goal: String("foo_echo"), RawMessage: json.RawMessage(`{"anything":"goes"}`)},
+		PolicyGoal{Goal: String("ixnay"), RawMessage: json.RawMessage(`{}`)},
+	})
+
+	if count := len(errs); count != 2 {
+		t.Error("expected 2, got", count, errs)
+	}
+}
+
+func TestServiceFactoryRegistryDefinitions(t *testing.T) {
+	r := NewServiceFactoryRegistry()
+	r.Register([]GoalDefinition{{Name: "foo_echo"}, {Name: "foo_do", Description: "does foo"}}, FooServiceFactory)
+
+	definitions := r.Definitions()
+	if count := len(definitions); count != 2 {
+		t.Fatal("expected 2, got", count)
+	}
+
+	if definitions[0].Name != "foo_do" || definitions[0].Description != "does foo" {
+		t.Error("expected definitions sorted by name, got", definitions)
+	}
+}
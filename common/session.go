@@ -1,49 +1,237 @@
 package common
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 )
 
+// GoalResult records the outcome of a single policy goal
+type GoalResult struct {
+	Goal    string
+	Changes []Change
+	Err     error
+
+	// SkipReason explains why the goal wasn't applied, if it wasn't
+	SkipReason string
+}
+
+// IsSkipped reports whether the goal was skipped
+func (r *GoalResult) IsSkipped() bool {
+	return r.SkipReason != ""
+}
+
 type Session struct {
 	*Policy
 	*Facts
 	*log.Logger
 	*ServiceFactoryRegistry
+
+	// ContinueOnError keeps the session running after a goal fails
+	ContinueOnError bool
+
+	// Results records the outcome of each goal in the order it was applied
+	Results []GoalResult
+
+	// Err records the failure that ended the session, if any
+	Err error
+}
+
+// NewLogger creates a logger prefixed with the repository described by facts
+func NewLogger(f *Facts) *log.Logger {
+	prefix := ""
+	if f.IsAvailable("repo.url") {
+		prefix = fmt.Sprintf("%s - ", f.GetString("repo.url"))
+	}
+	return log.New(os.Stdout, prefix, log.LstdFlags)
 }
 
 // NewSession creates a new session configured with the policy, facts, and globally-registered services
 func NewSession(rp *Policy, f *Facts) *Session {
-	logger := log.New(os.Stdout, fmt.Sprintf("%s - ", f.GetString("repo.url")), log.LstdFlags)
 	factories := ServiceFactories()
-	s := Session{rp, f, logger, &factories}
+	s := Session{
+		Policy:                 rp,
+		Facts:                  f,
+		Logger:                 NewLogger(f),
+		ServiceFactoryRegistry: &factories,
+	}
 	return &s
 }
 
 // Run the session
 func (s *Session) Run() error {
+	s.Err = s.run()
+	return s.Err
+}
 
-	s.Logger.Println("BEGIN")
+// Changes lists the changes recorded by all goals, in order
+func (s *Session) Changes() []Change {
+	var changes []Change
+	for _, r := range s.Results {
+		changes = append(changes, r.Changes...)
+	}
+	return changes
+}
 
-	services, err := s.ServiceFactoryRegistry.CreateServices(s.Policy.Goals(), s.Facts)
+// Failures lists the results of goals that failed
+func (s *Session) Failures() []GoalResult {
+	var failures []GoalResult
+	for _, r := range s.Results {
+		if r.Err != nil {
+			failures = append(failures, r)
+		}
+	}
+	return failures
+}
+
+// IsDrifted reports whether the session found any resource out of line with
+// the policy
+func (s *Session) IsDrifted() bool {
+	for _, c := range s.Changes() {
+		if c.IsChanged() {
+			return true
+		}
+	}
+	return false
+}
+
+// flushServices completes any work the session's services have deferred,
+// recording a failure as the result of a "flush" step
+func (s *Session) flushServices(services *ServiceRegistry) error {
+	flushed := map[*Service]bool{}
+	for _, svc := range *services {
+		if flushed[svc] {
+			continue
+		}
+		flushed[svc] = true
+
+		if f, ok := (*svc).(Flusher); ok {
+			if err := f.Flush(); err != nil {
+				s.Results = append(s.Results, GoalResult{Goal: "flush", Err: err})
+				s.Logger.Println("FAILED", err)
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// closeServices releases any resources (e.g. external processes) held by the
+// session's services
+func (s *Session) closeServices(services *ServiceRegistry) {
+	closed := map[*Service]bool{}
+	for _, svc := range *services {
+		if closed[svc] {
+			continue
+		}
+		closed[svc] = true
+
+		if c, ok := (*svc).(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				s.Logger.Println("failed closing service:", err)
+			}
+		}
+	}
+}
+
+func (s *Session) run() error {
+
+	if s.Facts.IsDryRun() {
+		s.Logger.Println("BEGIN (dry run)")
+	} else {
+		s.Logger.Println("BEGIN")
+	}
+
+	// Decide which goals apply to the repository, then resolve references to
+	// facts and validate each goal before applying any of them so that a
+	// misconfigured goal can't leave the repository partially updated
+	goals := make([]json.RawMessage, len(*s.Policy))
+	skipped := make([]*Condition, len(*s.Policy))
+	var applicable []string
+	for i, pg := range *s.Policy {
+		if skipped[i] = pg.Unmet(s.Facts); skipped[i] != nil {
+			continue
+		}
+
+		raw, err := Interpolate(pg.RawMessage, s.Facts)
+		if err != nil {
+			err = errors.New(fmt.Sprintf("%s: %s", *pg.Goal, err))
+			s.Logger.Println("FAILED", err)
+			return err
+		}
+
+		if err := s.ServiceFactoryRegistry.ValidateGoal(*pg.Goal, raw); err != nil {
+			s.Logger.Println("FAILED", err)
+			return err
+		}
+		goals[i] = raw
+		applicable = append(applicable, *pg.Goal)
+	}
+
+	services, err := s.ServiceFactoryRegistry.CreateServices(applicable, s.Facts)
+	defer s.closeServices(services)
 	if err != nil {
 		s.Logger.Println("FAILED", err)
 		return err
 	}
 
-	for _, pg := range *s.Policy {
+	// Deferred work is completed even if a goal fails, since goals applied
+	// before the failure would otherwise have taken effect
+	applyErr := s.applyGoals(services, goals, skipped)
+	if err := s.flushServices(services); err != nil && applyErr == nil {
+		return err
+	}
+	if applyErr != nil {
+		return applyErr
+	}
+
+	if failures := s.Failures(); len(failures) > 0 {
+		err := errors.New(fmt.Sprintf("%d of %d goals failed", len(failures), len(*s.Policy)))
+		s.Logger.Println("FAILED", err)
+		return err
+	}
+
+	s.Logger.Println("END")
+	return nil
+}
+
+// applyGoals applies each goal in the policy, returning an error if a failure
+// ends the session early
+func (s *Session) applyGoals(services *ServiceRegistry, goals []json.RawMessage, skipped []*Condition) error {
+	for i, pg := range *s.Policy {
 
 		goalName := *pg.Goal
 		s.Logger.Println(" --", goalName)
 
+		if skipped[i] != nil {
+			reason := fmt.Sprintf("unmet condition '%s'", skipped[i])
+			s.Logger.Println("SKIPPED", reason)
+			s.Results = append(s.Results, GoalResult{Goal: goalName, SkipReason: reason})
+			continue
+		}
+
 		svc := (*services)[goalName]
-		if err := (*svc).Do(goalName, &pg.RawMessage); err != nil {
+		changes, err := (*svc).Do(goalName, &goals[i])
+
+		result := GoalResult{Goal: goalName, Err: err}
+		if err != nil {
+			s.Results = append(s.Results, result)
 			s.Logger.Println("FAILED", err)
+			if s.ContinueOnError {
+				continue
+			}
 			return err
 		}
-	}
 
-	s.Logger.Println("END")
+		for _, c := range changes {
+			c.Goal = goalName
+			s.Logger.Println("   ", c.Action, c.Resource)
+			result.Changes = append(result.Changes, c)
+		}
+		s.Results = append(s.Results, result)
+	}
 	return nil
 }
@@ -0,0 +1,310 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"testing"
+)
+
+func sessionFixture(p Policy) *Session {
+	r := NewServiceFactoryRegistry()
+	r.Register(FooGoals, FooServiceFactory)
+	logger := log.New(ioutil.Discard, "", 0)
+	return &Session{Policy: &p, Facts: &Facts{}, Logger: logger, ServiceFactoryRegistry: r}
+}
+
+func TestSessionRunCollectsChanges(t *testing.T) {
+	s := sessionFixture(Policy{
+		PolicyGoal{Goal: String("foo_do"), RawMessage: json.RawMessage(`{"bar":"baz"}`)},
+		PolicyGoal{Goal: String("foo_echo"), RawMessage: json.RawMessage(`{"bar":"baz"}`)},
+	})
+
+	if err := s.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	changes := s.Changes()
+	if count := len(changes); count != 2 {
+		t.Fatal("expected 2, got", count)
+	}
+
+	if changes[0].Goal != "foo_do" || changes[1].Goal != "foo_echo" {
+		t.Error("expected changes to be attributed to goals, got", changes)
+	}
+
+	if s.IsDrifted() {
+		t.Error("expected no drift, got", changes)
+	}
+}
+
+func TestSessionRunStopsOnFailure(t *testing.T) {
+	s := sessionFixture(Policy{
+		PolicyGoal{Goal: String("foo_do"), RawMessage: json.RawMessage(`{"bar":"bad"}`)},
+		PolicyGoal{Goal: String("foo_echo"), RawMessage: json.RawMessage(`{"bar":"baz"}`)},
+	})
+
+	if err := s.Run(); err == nil || s.Err != err {
+		t.Error("expected error to be recorded, didn't get it.")
+	}
+
+	if count := len(s.Results); count != 1 {
+		t.Error("expected 1, got", count)
+	}
+}
+
+func TestSessionRunContinueOnError(t *testing.T) {
+	s := sessionFixture(Policy{
+		PolicyGoal{Goal: String("foo_do"), RawMessage: json.RawMessage(`{"bar":"bad"}`)},
+		PolicyGoal{Goal: String("foo_echo"), RawMessage: json.RawMessage(`{"bar":"baz"}`)},
+	})
+	s.ContinueOnError = true
+
+	if err := s.Run(); err == nil {
+		t.Error("expected error, didn't get it.")
+	}
+
+	if count := len(s.Results); count != 2 {
+		t.Fatal("expected 2, got", count)
+	}
+
+	if count := len(s.Failures()); count != 1 {
+		t.Error("expected 1, got", count)
+	}
+
+	if count := len(s.Changes()); count != 1 {
+		t.Error("expected 1, got", count)
+	}
+}
+
+func TestSessionRunInterpolatesFacts(t *testing.T) {
+	s := sessionFixture(Policy{
+		PolicyGoal{Goal: String("foo_do"), RawMessage: json.RawMessage(`{"bar":"{{repo.bar}}"}`)},
+	})
+	s.Facts.SetString("repo.bar", "baz")
+
+	if err := s.Run(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSessionRunUnknownFact(t *testing.T) {
+	s := sessionFixture(Policy{
+		PolicyGoal{Goal: String("foo_do"), RawMessage: json.RawMessage(`{"bar":"baz"}`)},
+		PolicyGoal{Goal: String("foo_echo"), RawMessage: json.RawMessage(`{"bar":"{{repo.bar}}"}`)},
+	})
+
+	if err := s.Run(); err == nil {
+		t.Error("expected error, didn't get it.")
+	}
+
+	if count := len(s.Results); count != 0 {
+		t.Error("expected no goals to be applied, got", count)
+	}
+}
+
+func TestSessionRunSkipsUnmetConditions(t *testing.T) {
+	when, _ := ParseCondition("repo.team == platform")
+	s := sessionFixture(Policy{
+		PolicyGoal{Goal: String("foo_do"), RawMessage: json.RawMessage(`{"bar":"baz"}`), When: []Condition{*when}},
+		PolicyGoal{Goal: String("foo_echo"), RawMessage: json.RawMessage(`{"bar":"baz"}`)},
+	})
+
+	if err := s.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !s.Results[0].IsSkipped() || s.Results[1].IsSkipped() {
+		t.Error("expected only first goal to be skipped, got", s.Results)
+	}
+}
+
+func TestSessionRunValidatesGoals(t *testing.T) {
+	s := sessionFixture(Policy{
+		PolicyGoal{Goal: String("foo_echo"), RawMessage: json.RawMessage(`{"bar":"baz"}`)},
+		PolicyGoal{Goal: String("foo_do"), RawMessage: json.RawMessage(`{"baz":"bar"}`)},
+	})
+
+	if err := s.Run(); err == nil {
+		t.Error("expected error, didn't get it.")
+	}
+
+	if count := len(s.Results); count != 0 {
+		t.Error("expected no goals to be applied, got", count)
+	}
+}
+
+type closingService struct {
+	FooService
+	closed int
+}
+
+func (cs *closingService) Close() error {
+	cs.closed++
+	return nil
+}
+
+func TestSessionRunClosesServices(t *testing.T) {
+	cs := &closingService{}
+	r := NewServiceFactoryRegistry()
+	r.Register(FooGoals, func(f *Facts) (*Service, error) {
+		svc := Service(cs)
+		return &svc, nil
+	})
+
+	s := sessionFixture(Policy{
+		PolicyGoal{Goal: String("foo_do"), RawMessage: json.RawMessage(`{"bar":"baz"}`)},
+		PolicyGoal{Goal: String("foo_echo"), RawMessage: json.RawMessage(`{"bar":"baz"}`)},
+	})
+	s.ServiceFactoryRegistry = r
+
+	if err := s.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if cs.closed != 1 {
+		t.Error("expected service to be closed once, got", cs.closed)
+	}
+}
+
+func TestSessionRunClosesServicesOnFailedCreate(t *testing.T) {
+	cs := &closingService{}
+	r := NewServiceFactoryRegistry()
+	r.Register([]GoalDefinition{{Name: "foo_do"}}, func(f *Facts) (*Service, error) {
+		svc := Service(cs)
+		return &svc, nil
+	})
+	r.Register([]GoalDefinition{{Name: "broken_task"}}, func(f *Facts) (*Service, error) {
+		return nil, errors.New("service failed to start")
+	})
+
+	s := sessionFixture(Policy{
+		PolicyGoal{Goal: String("foo_do"), RawMessage: json.RawMessage(`{"bar":"baz"}`)},
+		PolicyGoal{Goal: String("broken_task"), RawMessage: json.RawMessage(`{}`)},
+	})
+	s.ServiceFactoryRegistry = r
+
+	if err := s.Run(); err == nil {
+		t.Fatal("expected error when service failed to start; didn't get it.")
+	}
+
+	if cs.closed != 1 {
+		t.Error("expected created service to be closed once, got", cs.closed)
+	}
+}
+
+type flushingService struct {
+	FooService
+	flushed int
+	err     error
+}
+
+func (fs *flushingService) Flush() error {
+	fs.flushed++
+	return fs.err
+}
+
+func TestSessionRunFlushesServices(t *testing.T) {
+	fs := &flushingService{}
+	r := NewServiceFactoryRegistry()
+	r.Register(FooGoals, func(f *Facts) (*Service, error) {
+		svc := Service(fs)
+		return &svc, nil
+	})
+
+	s := sessionFixture(Policy{
+		PolicyGoal{Goal: String("foo_do"), RawMessage: json.RawMessage(`{"bar":"baz"}`)},
+		PolicyGoal{Goal: String("foo_echo"), RawMessage: json.RawMessage(`{"bar":"baz"}`)},
+	})
+	s.ServiceFactoryRegistry = r
+
+	if err := s.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if fs.flushed != 1 {
+		t.Error("expected service to be flushed once, got", fs.flushed)
+	}
+}
+
+func TestSessionRunFlushFails(t *testing.T) {
+	fs := &flushingService{err: errors.New("flush failed")}
+	r := NewServiceFactoryRegistry()
+	r.Register(FooGoals, func(f *Facts) (*Service, error) {
+		svc := Service(fs)
+		return &svc, nil
+	})
+
+	s := sessionFixture(Policy{
+		PolicyGoal{Goal: String("foo_do"), RawMessage: json.RawMessage(`{"bar":"baz"}`)},
+	})
+	s.ServiceFactoryRegistry = r
+
+	if err := s.Run(); err != fs.err {
+		t.Error("expected flush error, got", err)
+	}
+
+	failures := s.Failures()
+	if len(failures) != 1 || failures[0].Goal != "flush" {
+		t.Error("expected flush failure to be recorded, got", failures)
+	}
+}
+
+// recordingService reports creating a resource for each goal, recording the
+// calls it would make to do so unless it's in a dry run
+type recordingService struct {
+	dryRun    bool
+	mutations []string
+}
+
+func (rs *recordingService) Do(goal string, msg *json.RawMessage) ([]Change, error) {
+	if !rs.dryRun {
+		rs.mutations = append(rs.mutations, goal)
+	}
+	return []Change{{Resource: goal, Action: Create}}, nil
+}
+
+func recordingSessionFixture(dryRun bool) (*Session, *recordingService) {
+	rs := &recordingService{}
+	r := NewServiceFactoryRegistry()
+	r.Register(FooGoals, func(f *Facts) (*Service, error) {
+		rs.dryRun = f.IsDryRun()
+		svc := Service(rs)
+		return &svc, nil
+	})
+
+	s := sessionFixture(Policy{
+		PolicyGoal{Goal: String("foo_do"), RawMessage: json.RawMessage(`{"bar":"baz"}`)},
+		PolicyGoal{Goal: String("foo_echo"), RawMessage: json.RawMessage(`{"bar":"baz"}`)},
+	})
+	s.Facts = NewFacts(map[string]interface{}{DryRunFact: dryRun})
+	s.ServiceFactoryRegistry = r
+	return s, rs
+}
+
+func TestSessionRunDryRun(t *testing.T) {
+	s, rs := recordingSessionFixture(true)
+	if err := s.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if count := len(s.Changes()); count != 2 || !s.IsDrifted() {
+		t.Error("expected 2 changes to be reported, got", s.Changes())
+	}
+
+	if len(rs.mutations) > 0 {
+		t.Error("expected no changes to be made, got", rs.mutations)
+	}
+}
+
+func TestSessionRunAppliesChanges(t *testing.T) {
+	s, rs := recordingSessionFixture(false)
+	if err := s.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if count := len(rs.mutations); count != 2 {
+		t.Error("expected 2 changes to be made, got", rs.mutations)
+	}
+}
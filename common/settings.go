@@ -0,0 +1,40 @@
+package common
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// SettingsValues flattens settings into their JSON representation
+func SettingsValues(settings interface{}) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// SettingsMatch reports whether every setting specified in desired already
+// has the same value in current
+func SettingsMatch(current, desired interface{}) bool {
+	currentValues, err := SettingsValues(current)
+	if err != nil {
+		return false
+	}
+
+	desiredValues, err := SettingsValues(desired)
+	if err != nil {
+		return false
+	}
+
+	for k, v := range desiredValues {
+		if !reflect.DeepEqual(currentValues[k], v) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,27 @@
+package common
+
+import (
+	"testing"
+)
+
+type settingsFixture struct {
+	Name   *string  `json:"name,omitempty"`
+	Public *bool    `json:"public,omitempty"`
+	Topics []string `json:"topics,omitempty"`
+}
+
+func TestSettingsMatch(t *testing.T) {
+	current := settingsFixture{Name: String("hubbub"), Public: Bool(true), Topics: []string{"go"}}
+
+	if !SettingsMatch(&current, &settingsFixture{Public: Bool(true), Topics: []string{"go"}}) {
+		t.Error("expected specified settings to match")
+	}
+
+	if SettingsMatch(&current, &settingsFixture{Public: Bool(false)}) {
+		t.Error("expected differing setting not to match")
+	}
+
+	if SettingsMatch(&settingsFixture{}, &settingsFixture{Name: String("hubbub")}) {
+		t.Error("expected missing setting not to match")
+	}
+}
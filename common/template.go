@@ -0,0 +1,77 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// isTemplateFact reports whether a fact may be used in templates. Only facts
+// about the repository are available, keeping credentials (e.g.
+// `github.access_token`) out of rendered files.
+func isTemplateFact(k string) bool {
+	return strings.HasPrefix(k, "repo.")
+}
+
+// templateData nests facts by their namespaces, so that `repo.name` may be
+// referenced in a template as `{{ .repo.name }}`
+func templateData(f *Facts) map[string]interface{} {
+	var keys []string
+	for k := range *f {
+		if isTemplateFact(k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	data := map[string]interface{}{}
+	for _, k := range keys {
+		parts := strings.Split(k, ".")
+		scope := data
+		for _, part := range parts[:len(parts)-1] {
+			next, ok := scope[part].(map[string]interface{})
+			if !ok {
+				if scope[part] != nil {
+					// a fact already occupies the namespace
+					scope = nil
+					break
+				}
+				next = map[string]interface{}{}
+				scope[part] = next
+			}
+			scope = next
+		}
+		if scope != nil && scope[parts[len(parts)-1]] == nil {
+			scope[parts[len(parts)-1]] = f.Get(k)
+		}
+	}
+	return data
+}
+
+// RenderTemplate renders text as a Go template with the repository facts in
+// f. Facts may be referenced by namespace (`{{ .repo.name }}`) or by name
+// (`{{ fact "repo.name" }}`); referring to an unknown fact is an error.
+func RenderTemplate(name, text string, f *Facts) (string, error) {
+	funcs := template.FuncMap{
+		"fact": func(k string) (interface{}, error) {
+			if !isTemplateFact(k) || !f.IsAvailable(k) {
+				return nil, errors.New(fmt.Sprintf("unknown fact '%s'", k))
+			}
+			return f.Get(k), nil
+		},
+	}
+
+	tmpl, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, templateData(f)); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
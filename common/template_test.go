@@ -0,0 +1,65 @@
+package common
+
+import (
+	"testing"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	text := `{{ .repo.owner }}/{{ .repo.name }}{{ if eq (fact "repo.tier") 2 }} (tier 2){{ end }}`
+	rendered, err := RenderTemplate("README.md", text, interpolationFacts())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rendered != "rjz/hubbub (tier 2)" {
+		t.Error("expected rendered template, got", rendered)
+	}
+}
+
+func TestRenderTemplateUnknownFact(t *testing.T) {
+	for _, text := range []string{`{{ .repo.team }}`, `{{ fact "repo.team" }}`} {
+		if _, err := RenderTemplate("CODEOWNERS", text, interpolationFacts()); err == nil {
+			t.Error("expected error rendering", text)
+		}
+	}
+}
+
+func TestTemplateDataNamespaces(t *testing.T) {
+	f := NewFacts(map[string]interface{}{
+		"repo.name":       "hubbub",
+		"repo.team":       "platform",
+		"repo.team.lead":  "rjz",
+		"repo.ci.enabled": true,
+	})
+
+	repo := templateData(f)["repo"].(map[string]interface{})
+	if repo["team"] != "platform" {
+		t.Error("expected fact to take precedence over its namespace, got", repo["team"])
+	}
+
+	if enabled := repo["ci"].(map[string]interface{})["enabled"]; enabled != true {
+		t.Error("expected nested fact, got", enabled)
+	}
+}
+
+func TestRenderTemplateHidesTokens(t *testing.T) {
+	f := interpolationFacts()
+	f.SetString("github.access_token", "xyz")
+	f.SetString("travis.org_token", "abc")
+	f.SetString("travis.pro_token", "def")
+
+	if _, ok := templateData(f)["github"]; ok {
+		t.Error("expected github facts to be unavailable to templates")
+	}
+
+	for _, text := range []string{
+		`{{ .github.access_token }}`,
+		`{{ .travis.org_token }}`,
+		`{{ fact "github.access_token" }}`,
+		`{{ fact "travis.pro_token" }}`,
+	} {
+		if rendered, err := RenderTemplate("README.md", text, f); err == nil {
+			t.Error("expected error rendering", text, "got", rendered)
+		}
+	}
+}
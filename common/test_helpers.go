@@ -7,17 +7,27 @@ import (
 
 type FooService struct{}
 
-func (m *FooService) Do(name string, msg *json.RawMessage) error {
+func (m *FooService) Do(name string, msg *json.RawMessage) ([]Change, error) {
 	if name != "foo_do" && name != "foo_echo" {
-		return errors.New("unknown foo action")
+		return nil, errors.New("unknown foo action")
 	}
 
 	dst := make(map[string]interface{})
 	json.Unmarshal(*msg, &dst)
 	if dst["bar"].(string) != "baz" {
-		return errors.New("unexpected value")
+		return nil, errors.New("unexpected value")
 	}
-	return nil
+	return []Change{{Resource: "bar", Action: Unchanged}}, nil
+}
+
+// FooGoals defines the goals served by FooService
+var FooGoals = []GoalDefinition{
+	{Name: "foo_do", Schema: &Schema{
+		Type:       "object",
+		Required:   []string{"bar"},
+		Properties: map[string]*Schema{"bar": {Type: "string"}},
+	}},
+	{Name: "foo_echo"},
 }
 
 func FooServiceFactory(pc *Facts) (*Service, error) {
@@ -5,3 +5,15 @@ func String(s string) *string {
 	*str = s
 	return str
 }
+
+func Bool(b bool) *bool {
+	v := new(bool)
+	*v = b
+	return v
+}
+
+func Int(i int) *int {
+	v := new(int)
+	*v = i
+	return v
+}
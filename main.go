@@ -6,8 +6,11 @@ import (
 	hubbubCli "github.com/rjz/hubbub/cli"
 	hubbub "github.com/rjz/hubbub/common"
 	_ "github.com/rjz/hubbub/services"
+	external "github.com/rjz/hubbub/services/external"
+	"io"
 	"os"
 	"sync"
+	"time"
 )
 
 // environmentalFacts provides defaults from the environment
@@ -24,40 +27,227 @@ func environmentalFacts() map[string]interface{} {
 	return envFacts
 }
 
-// exec loads a policyFile and a repoFile and applies the policy to each repo
-func exec(policyFileName, reposFileName *string) {
+// pluginsDir is the directory containing external services
+func pluginsDir() string {
+	if dir := os.Getenv("HUBBUB_PLUGINS_DIR"); dir != "" {
+		return dir
+	}
+	return "./plugins"
+}
+
+// loadPlugins registers the goals offered by external services. It's only
+// needed by commands that use goal definitions, so that a broken plugin
+// doesn't stop hubbub from listing policies or repositories.
+func loadPlugins() {
+	if err := external.RegisterPlugins(pluginsDir()); err != nil {
+		fmt.Println("Failed loading plugins")
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// runOptions control how a policy is applied
+type runOptions struct {
+	// DryRun reports changes without making them
+	DryRun bool
+
+	// ContinueOnError keeps applying goals after one fails
+	ContinueOnError bool
 
-	reposFile := fmt.Sprintf("./config/repos/%s.json", *reposFileName)
-	repositories, err := hubbub.LoadRepositories(reposFile)
+	// Logs receives the output of each session
+	Logs io.Writer
+
+	// Concurrency limits the number of sessions run at once
+	Concurrency int
+
+	// Facts are added to the facts of every session
+	Facts map[string]interface{}
+}
+
+// newRunOptions reads the options shared by commands that apply a policy
+func newRunOptions(c *cli.Context) runOptions {
+	return runOptions{
+		Logs:        os.Stdout,
+		Concurrency: c.Int("concurrency"),
+		Facts: map[string]interface{}{
+			hubbub.RetryAttemptsFact: c.Int("retries") + 1,
+			hubbub.RetryBackoffFact:  c.Int("retry-backoff"),
+			hubbub.RetryJitterFact:   c.Int("retry-jitter"),
+			"github.batch_commits":   c.Bool("batch-commits"),
+		},
+	}
+}
+
+// loadPolicy resolves and loads the named policy, exiting if it can't
+func loadPolicy(policyFileName *string) hubbub.Policy {
+	policyFile, err := hubbub.ResolveConfigFile("./config/policies", *policyFileName)
 	if err != nil {
-		fmt.Printf("Failed loading repositories '%s'\n", reposFile)
 		fmt.Println(err)
 		os.Exit(1)
 	}
 
-	policyFile := fmt.Sprintf("./config/policies/%s.json", *policyFileName)
-	Policy, err := hubbub.LoadPolicy(policyFile)
+	policy, err := hubbub.LoadPolicy(policyFile)
 	if err != nil {
 		fmt.Printf("Failed loading policy '%s'\n", policyFile)
 		fmt.Println(err)
 		os.Exit(1)
 	}
+	return policy
+}
 
-	var wg sync.WaitGroup
+// runFacts are the facts shared by everything a run does: the environment's,
+// plus those set by its options
+func runFacts(opts runOptions) (*hubbub.Facts, error) {
+	facts := hubbub.NewFacts(environmentalFacts())
+	if err := facts.SetMap(opts.Facts); err != nil {
+		return nil, err
+	}
+	if err := facts.SetBool(hubbub.DryRunFact, opts.DryRun); err != nil {
+		return nil, err
+	}
+	return facts, nil
+}
+
+// exec loads a policyFile and a repoFile and applies the policy to each repo,
+// returning the finished sessions in the order the repos were listed.
+func exec(policyFileName, reposFileName *string, opts runOptions) []*hubbub.Session {
+
+	reposFile, err := hubbub.ResolveConfigFile("./config/repos", *reposFileName)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	// repositories are discovered with the same facts (e.g. retry policy) as
+	// the sessions that are run on them
+	discoveryFacts, err := runFacts(opts)
+	if err != nil {
+		fmt.Println("Failed loading facts")
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	repositories, err := hubbub.LoadRepositories(reposFile, discoveryFacts)
+	if err != nil {
+		fmt.Printf("Failed loading repositories '%s'\n", reposFile)
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	Policy := loadPolicy(policyFileName)
+
+	var sessions []*hubbub.Session
 	for _, repo := range *repositories {
 
-		facts := hubbub.NewFacts(environmentalFacts())
-		facts.SetRepository(&repo)
+		facts, err := runFacts(opts)
+		if err == nil {
+			err = facts.SetRepository(&repo)
+		}
+		if err != nil {
+			fmt.Printf("Failed loading facts for '%s'\n", repo.URL)
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		repoPolicy := Policy.Merge(repo.Overrides)
+		sess := hubbub.NewSession(&repoPolicy, facts)
+		sess.ContinueOnError = opts.ContinueOnError
+		sess.Logger.SetOutput(opts.Logs)
+		sessions = append(sessions, sess)
+	}
+
+	runSessions(sessions, opts.Concurrency)
+	return sessions
+}
 
+// runSessions runs sessions on a pool of (at most) concurrency workers
+func runSessions(sessions []*hubbub.Session, concurrency int) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	queue := make(chan *hubbub.Session)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
 		wg.Add(1)
-		go func(sess *hubbub.Session) {
-			sess.Run()
+		go func() {
+			for sess := range queue {
+				sess.Run()
+			}
 			wg.Done()
-		}(hubbub.NewSession(&Policy, facts))
+		}()
 	}
+
+	for _, sess := range sessions {
+		queue <- sess
+	}
+	close(queue)
 	wg.Wait()
 }
 
+// report lists the changes made (or planned) by each session and exits with
+// a non-zero status if any of them failed
+func report(sessions []*hubbub.Session) {
+	for _, sess := range sessions {
+		hubbubCli.ListResults(sess.Facts.GetString("repo.url"), sess.Results)
+	}
+	os.Exit(hubbubCli.PrintSummary(sessions))
+}
+
+// policyFlags select the policy and repositories a command acts on
+var policyFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "repositories",
+		Usage: "name of repository list",
+	},
+	cli.StringFlag{
+		Name:  "policy",
+		Usage: "name of policy",
+	},
+}
+
+var continueOnErrorFlag = cli.BoolFlag{
+	Name:  "continue-on-error",
+	Usage: "keep applying goals after one fails",
+}
+
+// runFlags tune how a policy is applied
+var runFlags = []cli.Flag{
+	cli.IntFlag{
+		Name:  "concurrency",
+		Usage: "maximum number of repositories to process at once",
+		Value: 4,
+	},
+	cli.IntFlag{
+		Name:  "retries",
+		Usage: "number of times to retry requests that fail for transient reasons",
+		Value: hubbub.DefaultRetryPolicy.Attempts - 1,
+	},
+	cli.IntFlag{
+		Name:  "retry-backoff",
+		Usage: "milliseconds to wait before the first retry (doubling for each subsequent retry)",
+		Value: int(hubbub.DefaultRetryPolicy.Backoff / time.Millisecond),
+	},
+	cli.IntFlag{
+		Name:  "retry-jitter",
+		Usage: "percentage by which to randomly vary each retry delay",
+		Value: int(hubbub.DefaultRetryPolicy.Jitter * 100),
+	},
+	cli.BoolFlag{
+		Name:  "batch-commits",
+		Usage: "commit all file changes to a branch together, rather than one at a time",
+	},
+}
+
+// commandFlags combines groups of flags
+func commandFlags(groups ...[]cli.Flag) []cli.Flag {
+	var flags []cli.Flag
+	for _, g := range groups {
+		flags = append(flags, g...)
+	}
+	return flags
+}
+
 func main() {
 	app := cli.NewApp()
 	app.Name = "hubbub"
@@ -68,8 +258,19 @@ func main() {
 			Name:  "goals",
 			Usage: "list available policy goals",
 			Action: func(c *cli.Context) {
+				loadPlugins()
 				hubbubCli.ListPolicyGoals()
 			},
+			Subcommands: []cli.Command{
+				{
+					Name:  "describe",
+					Usage: "document a goal (or, if none is named, every goal)",
+					Action: func(c *cli.Context) {
+						loadPlugins()
+						hubbubCli.DescribeGoal(c.Args().First())
+					},
+				},
+			},
 		},
 		{
 			Name:  "policies",
@@ -86,24 +287,69 @@ func main() {
 			},
 		},
 		{
-			Name:  "apply",
-			Usage: "apply policy",
+			Name:  "validate",
+			Usage: "check a policy's goals without applying them",
 			Action: func(c *cli.Context) {
-				reposFile := c.String("repositories")
+				loadPlugins()
 				policyFile := c.String("policy")
-				exec(&policyFile, &reposFile)
+				os.Exit(hubbubCli.ValidatePolicy(policyFile, loadPolicy(&policyFile)))
 			},
 			Flags: []cli.Flag{
-				cli.StringFlag{
-					Name:  "repositories",
-					Usage: "name of repository list",
-				},
 				cli.StringFlag{
 					Name:  "policy",
 					Usage: "name of policy",
 				},
 			},
 		},
+		{
+			Name:  "apply",
+			Usage: "apply policy",
+			Action: func(c *cli.Context) {
+				loadPlugins()
+				reposFile := c.String("repositories")
+				policyFile := c.String("policy")
+				opts := newRunOptions(c)
+				opts.DryRun = c.Bool("dry-run")
+				opts.ContinueOnError = c.Bool("continue-on-error")
+				report(exec(&policyFile, &reposFile, opts))
+			},
+			Flags: commandFlags(policyFlags, runFlags, []cli.Flag{
+				cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "report changes without making them",
+				},
+				continueOnErrorFlag,
+			}),
+		},
+		{
+			Name:  "plan",
+			Usage: "report the changes applying a policy would make",
+			Action: func(c *cli.Context) {
+				loadPlugins()
+				reposFile := c.String("repositories")
+				policyFile := c.String("policy")
+				opts := newRunOptions(c)
+				opts.DryRun = true
+				opts.ContinueOnError = c.Bool("continue-on-error")
+				report(exec(&policyFile, &reposFile, opts))
+			},
+			Flags: commandFlags(policyFlags, runFlags, []cli.Flag{continueOnErrorFlag}),
+		},
+		{
+			Name:  "check",
+			Usage: "exit non-zero if any repository has drifted from the policy",
+			Action: func(c *cli.Context) {
+				loadPlugins()
+				reposFile := c.String("repositories")
+				policyFile := c.String("policy")
+				opts := newRunOptions(c)
+				opts.DryRun = true
+				opts.ContinueOnError = true
+				opts.Logs = os.Stderr
+				os.Exit(hubbubCli.PrintCheckSummary(exec(&policyFile, &reposFile, opts)))
+			},
+			Flags: commandFlags(policyFlags, runFlags),
+		},
 	}
 
 	app.Run(os.Args)
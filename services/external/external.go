@@ -0,0 +1,257 @@
+package external_service
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	hubbub "github.com/rjz/hubbub/common"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Methods understood by external services
+const (
+	describeMethod  = "describe"
+	configureMethod = "configure"
+	doMethod        = "do"
+)
+
+// request is sent to an external service as a single line of JSON
+type request struct {
+	Method string           `json:"method"`
+	Facts  *hubbub.Facts    `json:"facts,omitempty"`
+	Goal   string           `json:"goal,omitempty"`
+	Params *json.RawMessage `json:"params,omitempty"`
+}
+
+// goalDefinition describes a goal offered by an external service
+type goalDefinition struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Schema      *hubbub.Schema  `json:"schema,omitempty"`
+	Example     json.RawMessage `json:"example,omitempty"`
+}
+
+// response is returned by an external service as a single line of JSON
+type response struct {
+	Goals   []goalDefinition `json:"goals,omitempty"`
+	Facts   []string         `json:"facts,omitempty"`
+	Changes []hubbub.Change  `json:"changes,omitempty"`
+	Error   string           `json:"error,omitempty"`
+}
+
+// Plugin is an executable implementing one or more goals
+type Plugin struct {
+	Command string
+	Args    []string
+
+	// Facts are any facts (besides `repo.*` and `hubbub.*`) that the plugin
+	// asked to be configured with, e.g. `github.access_token`
+	Facts []string
+}
+
+// process is a running plugin
+type process struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	mu     sync.Mutex
+}
+
+// start launches the plugin. Anything it writes to stderr is passed through
+// to hubbub's.
+func (p *Plugin) start() (*process, error) {
+	cmd := exec.Command(p.Command, p.Args...)
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &process{cmd: cmd, stdin: stdin, stdout: bufio.NewReader(stdout)}, nil
+}
+
+// call sends a request to the plugin and waits for its response
+func (proc *process) call(req request) (*response, error) {
+	proc.mu.Lock()
+	defer proc.mu.Unlock()
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := proc.stdin.Write(append(data, '\n')); err != nil {
+		return nil, err
+	}
+
+	line, err := proc.stdout.ReadBytes('\n')
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("no response to '%s': %s", req.Method, err))
+	}
+
+	resp := response{}
+	if err := json.Unmarshal(line, &resp); err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid response to '%s': %s", req.Method, err))
+	}
+
+	if resp.Error != "" {
+		return &resp, errors.New(resp.Error)
+	}
+	return &resp, nil
+}
+
+// Close ends the plugin's input and waits for it to exit
+func (proc *process) Close() error {
+	proc.stdin.Close()
+	return proc.cmd.Wait()
+}
+
+// Describe asks the plugin which goals it implements, noting any additional
+// facts it needs
+func (p *Plugin) Describe() ([]hubbub.GoalDefinition, error) {
+	proc, err := p.start()
+	if err != nil {
+		return nil, err
+	}
+	defer proc.Close()
+
+	resp, err := proc.call(request{Method: describeMethod})
+	if err != nil {
+		return nil, err
+	}
+	p.Facts = resp.Facts
+
+	var definitions []hubbub.GoalDefinition
+	for _, g := range resp.Goals {
+		d := hubbub.GoalDefinition{Name: g.Name, Description: g.Description, Schema: g.Schema}
+		if len(g.Example) > 0 {
+			example, err := json.MarshalIndent(g.Example, "", "  ")
+			if err != nil {
+				return nil, err
+			}
+			d.Example = string(example)
+		}
+		definitions = append(definitions, d)
+	}
+	return definitions, nil
+}
+
+// ExternalService serves goals using a plugin process started for a single
+// session
+type ExternalService struct {
+	proc *process
+}
+
+// Do asks the plugin to apply a goal
+func (es *ExternalService) Do(goal string, params *json.RawMessage) ([]hubbub.Change, error) {
+	resp, err := es.proc.call(request{Method: doMethod, Goal: goal, Params: params})
+	if resp == nil {
+		return nil, err
+	}
+	return resp.Changes, err
+}
+
+// Close stops the plugin process
+func (es *ExternalService) Close() error {
+	return es.proc.Close()
+}
+
+// isDefaultFact reports whether a fact is sent to every plugin. Others (e.g.
+// credentials) are only sent to plugins that ask for them.
+func isDefaultFact(k string) bool {
+	return strings.HasPrefix(k, "repo.") || strings.HasPrefix(k, "hubbub.")
+}
+
+// configureFacts selects the session facts the plugin may see
+func (p *Plugin) configureFacts(facts *hubbub.Facts) *hubbub.Facts {
+	requested := map[string]bool{}
+	for _, k := range p.Facts {
+		requested[k] = true
+	}
+
+	selected := hubbub.Facts{}
+	for k, v := range *facts {
+		if isDefaultFact(k) || requested[k] {
+			selected[k] = v
+		}
+	}
+	return &selected
+}
+
+// Factory returns a ServiceFactory that starts the plugin and configures it
+// with the session's facts
+func (p *Plugin) Factory() hubbub.ServiceFactory {
+	return func(facts *hubbub.Facts) (*hubbub.Service, error) {
+		proc, err := p.start()
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := proc.call(request{Method: configureMethod, Facts: p.configureFacts(facts)}); err != nil {
+			proc.Close()
+			return nil, errors.New(fmt.Sprintf("%s: %s", p.Command, err))
+		}
+
+		svc := hubbub.Service(&ExternalService{proc})
+		return &svc, nil
+	}
+}
+
+// Register describes the plugin and adds its goals to the global registry
+func (p *Plugin) Register() error {
+	definitions, err := p.Describe()
+	if err != nil {
+		return errors.New(fmt.Sprintf("%s: %s", p.Command, err))
+	}
+
+	serviceFactories := hubbub.ServiceFactories()
+	for _, d := range definitions {
+		if _, err := serviceFactories.Definition(d.Name); err == nil {
+			return errors.New(fmt.Sprintf("%s: goal '%s' was previously defined", p.Command, d.Name))
+		}
+	}
+
+	hubbub.RegisterService(definitions, p.Factory())
+	return nil
+}
+
+// RegisterPlugins registers every executable in dir as a plugin. A missing
+// directory has no plugins.
+func RegisterPlugins(dir string) error {
+	entries, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		return err
+	}
+
+	for _, path := range entries {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() || info.Mode()&0111 == 0 {
+			continue
+		}
+
+		p := Plugin{Command: path}
+		if err := p.Register(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
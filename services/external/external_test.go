@@ -0,0 +1,153 @@
+package external_service
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	hubbub "github.com/rjz/hubbub/common"
+	"os"
+	"testing"
+)
+
+// helperPlugin runs TestHelperPlugin as an external service
+func helperPlugin() *Plugin {
+	return &Plugin{
+		Command: os.Args[0],
+		Args:    []string{"-test.run=TestHelperPlugin", "--"},
+	}
+}
+
+// TestHelperPlugin isn't a real test: it implements the plugin protocol when
+// run by helperPlugin
+func TestHelperPlugin(t *testing.T) {
+	if os.Getenv("HUBBUB_HELPER_PLUGIN") != "1" {
+		return
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	var facts hubbub.Facts
+	for scanner.Scan() {
+		req := request{}
+		json.Unmarshal(scanner.Bytes(), &req)
+
+		resp := response{}
+		switch req.Method {
+		case describeMethod:
+			resp.Goals = []goalDefinition{{
+				Name:    "deploy_target",
+				Schema:  &hubbub.Schema{Type: "object", Required: []string{"env"}},
+				Example: json.RawMessage(`{"env":"staging"}`),
+			}}
+			resp.Facts = []string{"github.access_token"}
+		case configureMethod:
+			facts = *req.Facts
+		case doMethod:
+			params := map[string]string{}
+			json.Unmarshal(*req.Params, &params)
+			if params["fact"] != "" {
+				resp.Changes = []hubbub.Change{{Resource: params["fact"], After: facts.Get(params["fact"])}}
+				break
+			}
+			if params["env"] == "" {
+				resp.Error = "missing env"
+				break
+			}
+			resp.Changes = []hubbub.Change{{
+				Resource: fmt.Sprintf("%s/%s", facts.GetString("repo.name"), params["env"]),
+				Action:   hubbub.Create,
+			}}
+		}
+
+		data, _ := json.Marshal(resp)
+		fmt.Println(string(data))
+	}
+	os.Exit(0)
+}
+
+func TestPluginDescribe(t *testing.T) {
+	os.Setenv("HUBBUB_HELPER_PLUGIN", "1")
+	defer os.Unsetenv("HUBBUB_HELPER_PLUGIN")
+
+	definitions, err := helperPlugin().Describe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count := len(definitions); count != 1 {
+		t.Fatal("expected 1, got", count)
+	}
+
+	d := definitions[0]
+	if d.Name != "deploy_target" || d.Schema == nil {
+		t.Error("unexpected definition", d)
+	}
+
+	if err := d.Validate(json.RawMessage(d.Example)); err != nil {
+		t.Error("expected example to be valid, got", err)
+	}
+}
+
+func TestPluginDo(t *testing.T) {
+	os.Setenv("HUBBUB_HELPER_PLUGIN", "1")
+	defer os.Unsetenv("HUBBUB_HELPER_PLUGIN")
+
+	svc, err := helperPlugin().Factory()(hubbub.NewFacts(map[string]interface{}{"repo.name": "uno"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	es := (*svc).(*ExternalService)
+	defer es.Close()
+
+	params := json.RawMessage(`{"env":"staging"}`)
+	changes, err := es.Do("deploy_target", &params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count := len(changes); count != 1 || changes[0].Resource != "uno/staging" {
+		t.Error("unexpected changes", changes)
+	}
+
+	params = json.RawMessage(`{}`)
+	if _, err := es.Do("deploy_target", &params); err == nil || err.Error() != "missing env" {
+		t.Error("expected plugin's error, got", err)
+	}
+}
+
+func TestPluginConfigureFacts(t *testing.T) {
+	os.Setenv("HUBBUB_HELPER_PLUGIN", "1")
+	defer os.Unsetenv("HUBBUB_HELPER_PLUGIN")
+
+	p := helperPlugin()
+	if _, err := p.Describe(); err != nil {
+		t.Fatal(err)
+	}
+
+	svc, err := p.Factory()(hubbub.NewFacts(map[string]interface{}{
+		"repo.name":           "uno",
+		"hubbub.dry_run":      true,
+		"github.access_token": "secret",
+		"travis.org_token":    "secret",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	es := (*svc).(*ExternalService)
+	defer es.Close()
+
+	for fact, expected := range map[string]interface{}{
+		"repo.name":           "uno",
+		"hubbub.dry_run":      true,
+		"github.access_token": "secret",
+		"travis.org_token":    nil,
+	} {
+		params := json.RawMessage(fmt.Sprintf(`{"fact":"%s"}`, fact))
+		changes, err := es.Do("deploy_target", &params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := changes[0].After; actual != expected {
+			t.Errorf("%s: expected %v, got %v", fact, expected, actual)
+		}
+	}
+}
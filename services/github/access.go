@@ -0,0 +1,312 @@
+package github_service
+
+import (
+	"fmt"
+	"github.com/google/go-github/github"
+	hubbub "github.com/rjz/hubbub/common"
+	"sort"
+	"strings"
+)
+
+// permissions lists the levels of access to a repository, from least to most
+var permissions = []string{"pull", "triage", "push", "maintain", "admin"}
+
+// invitationPermissions maps the permissions github reports for invitations
+// to those used everywhere else
+var invitationPermissions = map[string]string{
+	"read":  "pull",
+	"write": "push",
+}
+
+// accessGrant describes the access a single team or user should have
+type accessGrant struct {
+	Team       string `json:"team,omitempty"`
+	User       string `json:"user,omitempty"`
+	Permission string `json:"permission,omitempty"`
+	State      string `json:"state,omitempty"`
+}
+
+// grantee names the team or user a grant applies to
+func (g *accessGrant) grantee() string {
+	if g.Team != "" {
+		return g.Team
+	}
+	return g.User
+}
+
+// accessor grants and revokes one kind of access to a repository
+type accessor interface {
+	grant(name, permission string) error
+	revoke(name string) error
+}
+
+// applyAccess brings the current access (permissions by lowercase grantee)
+// in line with the desired grants. In exclusive mode, grantees that aren't
+// listed lose their access.
+func applyAccess(current map[string]string, desired []accessGrant, exclusive, dryRun bool, a accessor) ([]hubbub.Change, error) {
+	var changes []hubbub.Change
+	listed := map[string]bool{}
+	for _, g := range desired {
+		name := g.grantee()
+		key := strings.ToLower(name)
+		listed[key] = true
+
+		existing, exists := current[key]
+		change := hubbub.Change{Resource: name}
+		if exists {
+			change.Before = existing
+		}
+
+		if g.State == "absent" {
+			if !exists {
+				change.Action = hubbub.Unchanged
+				changes = append(changes, change)
+				continue
+			}
+
+			change.Action = hubbub.Delete
+			changes = append(changes, change)
+			if !dryRun {
+				if err := a.revoke(name); err != nil {
+					return changes, err
+				}
+			}
+			continue
+		}
+
+		change.After = g.Permission
+		switch {
+		case !exists:
+			change.Action = hubbub.Create
+		case existing == g.Permission:
+			change.Action = hubbub.Unchanged
+		default:
+			change.Action = hubbub.Update
+		}
+
+		changes = append(changes, change)
+		if change.IsChanged() && !dryRun {
+			if err := a.grant(name, g.Permission); err != nil {
+				return changes, err
+			}
+		}
+	}
+
+	if !exclusive {
+		return changes, nil
+	}
+
+	var unlisted []string
+	for key := range current {
+		if !listed[key] {
+			unlisted = append(unlisted, key)
+		}
+	}
+	sort.Strings(unlisted)
+
+	for _, name := range unlisted {
+		changes = append(changes, hubbub.Change{Resource: name, Action: hubbub.Delete, Before: current[name]})
+		if dryRun {
+			continue
+		}
+		if err := a.revoke(name); err != nil {
+			return changes, err
+		}
+	}
+	return changes, nil
+}
+
+// highestPermission picks the most permissive of the permissions github
+// reports for a user
+func highestPermission(granted map[string]bool) string {
+	highest := ""
+	for _, p := range permissions {
+		if granted[p] {
+			highest = p
+		}
+	}
+	return highest
+}
+
+// TeamAccessService manages the access teams in the repository's
+// organization have to it
+type TeamAccessService struct {
+	Client    *github.Client
+	RepoOwner string
+	RepoName  string
+	DryRun    bool
+}
+
+func NewTeamAccessService(client *github.Client, owner, name string, dryRun bool) *TeamAccessService {
+	return &TeamAccessService{client, owner, name, dryRun}
+}
+
+// List fetches the permission of each team with access to the repository
+func (tas *TeamAccessService) List() (map[string]string, error) {
+	current := map[string]string{}
+	for page := 1; page != 0; {
+		req, err := tas.Client.NewRequest("GET", fmt.Sprintf("repos/%s/%s/teams?per_page=100&page=%d", tas.RepoOwner, tas.RepoName, page), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var teams []struct {
+			Slug       string `json:"slug"`
+			Permission string `json:"permission"`
+		}
+		resp, err := tas.Client.Do(req, &teams)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, t := range teams {
+			current[strings.ToLower(t.Slug)] = t.Permission
+		}
+		page = resp.NextPage
+	}
+	return current, nil
+}
+
+func (tas *TeamAccessService) path(team string) string {
+	return fmt.Sprintf("orgs/%s/teams/%s/repos/%s/%s", tas.RepoOwner, team, tas.RepoOwner, tas.RepoName)
+}
+
+func (tas *TeamAccessService) grant(team, permission string) error {
+	req, err := tas.Client.NewRequest("PUT", tas.path(team), map[string]string{"permission": permission})
+	if err != nil {
+		return err
+	}
+	_, err = tas.Client.Do(req, nil)
+	return err
+}
+
+func (tas *TeamAccessService) revoke(team string) error {
+	req, err := tas.Client.NewRequest("DELETE", tas.path(team), nil)
+	if err != nil {
+		return err
+	}
+	_, err = tas.Client.Do(req, nil)
+	return err
+}
+
+// Apply grants, changes or revokes team access
+func (tas *TeamAccessService) Apply(desired []accessGrant, exclusive bool) ([]hubbub.Change, error) {
+	current, err := tas.List()
+	if err != nil {
+		return nil, err
+	}
+	return applyAccess(current, desired, exclusive, tas.DryRun, tas)
+}
+
+// CollaboratorService manages the users with direct access to the repository
+type CollaboratorService struct {
+	Client    *github.Client
+	RepoOwner string
+	RepoName  string
+	DryRun    bool
+
+	// invitations are the IDs of pending invitations, by lowercase login
+	invitations map[string]int
+}
+
+func NewCollaboratorService(client *github.Client, owner, name string, dryRun bool) *CollaboratorService {
+	return &CollaboratorService{client, owner, name, dryRun, nil}
+}
+
+// List fetches the permission of each collaborator, including users who have
+// been invited but haven't yet accepted
+func (cs *CollaboratorService) List() (map[string]string, error) {
+	current := map[string]string{}
+	for page := 1; page != 0; {
+		req, err := cs.Client.NewRequest("GET", fmt.Sprintf("repos/%s/%s/collaborators?affiliation=direct&per_page=100&page=%d", cs.RepoOwner, cs.RepoName, page), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var users []struct {
+			Login       string          `json:"login"`
+			Permissions map[string]bool `json:"permissions"`
+		}
+		resp, err := cs.Client.Do(req, &users)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, u := range users {
+			current[strings.ToLower(u.Login)] = highestPermission(u.Permissions)
+		}
+		page = resp.NextPage
+	}
+
+	cs.invitations = map[string]int{}
+	for page := 1; page != 0; {
+		req, err := cs.Client.NewRequest("GET", fmt.Sprintf("repos/%s/%s/invitations?per_page=100&page=%d", cs.RepoOwner, cs.RepoName, page), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var invitations []struct {
+			ID      int `json:"id"`
+			Invitee struct {
+				Login string `json:"login"`
+			} `json:"invitee"`
+			Permissions string `json:"permissions"`
+		}
+		resp, err := cs.Client.Do(req, &invitations)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, i := range invitations {
+			permission := i.Permissions
+			if p, ok := invitationPermissions[permission]; ok {
+				permission = p
+			}
+			current[strings.ToLower(i.Invitee.Login)] = permission
+			cs.invitations[strings.ToLower(i.Invitee.Login)] = i.ID
+		}
+		page = resp.NextPage
+	}
+	return current, nil
+}
+
+func (cs *CollaboratorService) path(user string) string {
+	return fmt.Sprintf("repos/%s/%s/collaborators/%s", cs.RepoOwner, cs.RepoName, user)
+}
+
+// grant invites a user to collaborate (or updates their permission)
+func (cs *CollaboratorService) grant(user, permission string) error {
+	req, err := cs.Client.NewRequest("PUT", cs.path(user), map[string]string{"permission": permission})
+	if err != nil {
+		return err
+	}
+	_, err = cs.Client.Do(req, nil)
+	return err
+}
+
+// revoke removes a collaborator, or cancels their invitation
+func (cs *CollaboratorService) revoke(user string) error {
+	path := cs.path(user)
+	if id, ok := cs.invitations[strings.ToLower(user)]; ok {
+		path = fmt.Sprintf("repos/%s/%s/invitations/%d", cs.RepoOwner, cs.RepoName, id)
+	}
+
+	req, err := cs.Client.NewRequest("DELETE", path, nil)
+	if err != nil {
+		return err
+	}
+	_, err = cs.Client.Do(req, nil)
+	return err
+}
+
+// Apply grants, changes or revokes collaborators' access
+func (cs *CollaboratorService) Apply(desired []accessGrant, exclusive bool) ([]hubbub.Change, error) {
+	current, err := cs.List()
+	if err != nil {
+		return nil, err
+	}
+
+	// the owner of a personal repository can't be removed from it
+	delete(current, strings.ToLower(cs.RepoOwner))
+	return applyAccess(current, desired, exclusive, cs.DryRun, cs)
+}
@@ -0,0 +1,75 @@
+package github_service
+
+import (
+	hubbub "github.com/rjz/hubbub/common"
+	"reflect"
+	"testing"
+)
+
+// accessorFixture records the grants and revocations it's asked to make
+type accessorFixture struct {
+	granted map[string]string
+	revoked []string
+}
+
+func (a *accessorFixture) grant(name, permission string) error {
+	a.granted[name] = permission
+	return nil
+}
+
+func (a *accessorFixture) revoke(name string) error {
+	a.revoked = append(a.revoked, name)
+	return nil
+}
+
+func TestApplyAccess(t *testing.T) {
+	current := map[string]string{"core": "admin", "docs": "pull", "contractors": "push", "interns": "pull"}
+	desired := []accessGrant{
+		{Team: "Core", Permission: "admin"},
+		{Team: "docs", Permission: "push"},
+		{Team: "release", Permission: "maintain"},
+		{Team: "contractors", State: "absent"},
+	}
+
+	a := &accessorFixture{granted: map[string]string{}}
+	changes, err := applyAccess(current, desired, true, false, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []hubbub.Action{hubbub.Unchanged, hubbub.Update, hubbub.Create, hubbub.Delete, hubbub.Delete}
+	if len(changes) != len(expected) {
+		t.Fatal("expected", len(expected), "changes, got", changes)
+	}
+	for i, action := range expected {
+		if changes[i].Action != action {
+			t.Error("expected", action, "got", changes[i])
+		}
+	}
+
+	if !reflect.DeepEqual(a.granted, map[string]string{"docs": "push", "release": "maintain"}) {
+		t.Error("unexpected grants", a.granted)
+	}
+
+	if !reflect.DeepEqual(a.revoked, []string{"contractors", "interns"}) {
+		t.Error("unexpected revocations", a.revoked)
+	}
+}
+
+func TestApplyAccessDryRun(t *testing.T) {
+	a := &accessorFixture{granted: map[string]string{}}
+	changes, err := applyAccess(map[string]string{"rjz": "admin"}, []accessGrant{{User: "ghost", Permission: "pull"}}, true, true, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes) != 2 || len(a.granted) != 0 || len(a.revoked) != 0 {
+		t.Error("expected changes to be reported but not made, got", changes)
+	}
+}
+
+func TestHighestPermission(t *testing.T) {
+	if p := highestPermission(map[string]bool{"pull": true, "triage": true, "push": true}); p != "push" {
+		t.Error("expected push, got", p)
+	}
+}
@@ -0,0 +1,209 @@
+package github_service
+
+import (
+	"fmt"
+	"github.com/google/go-github/github"
+	hubbub "github.com/rjz/hubbub/common"
+	"reflect"
+	"sort"
+)
+
+// protectionPreview enables required review counts in github's API
+const protectionPreview = "application/vnd.github.luke-cage-preview+json"
+
+// requiredStatusChecks lists the checks that must pass before merging
+type requiredStatusChecks struct {
+	Strict   bool     `json:"strict"`
+	Contexts []string `json:"contexts"`
+}
+
+// requiredReviews describe the reviews required before merging
+type requiredReviews struct {
+	DismissStaleReviews          bool `json:"dismiss_stale_reviews"`
+	RequireCodeOwnerReviews      bool `json:"require_code_owner_reviews"`
+	RequiredApprovingReviewCount int  `json:"required_approving_review_count,omitempty"`
+}
+
+// pushRestrictions list the users and teams (by slug) allowed to push
+type pushRestrictions struct {
+	Users []string `json:"users"`
+	Teams []string `json:"teams"`
+}
+
+// BranchProtection describes the protection of a single branch in the form
+// github expects when it's updated. Omitted requirements are disabled.
+type BranchProtection struct {
+	RequiredStatusChecks       *requiredStatusChecks `json:"required_status_checks"`
+	EnforceAdmins              bool                  `json:"enforce_admins"`
+	RequiredPullRequestReviews *requiredReviews      `json:"required_pull_request_reviews"`
+	Restrictions               *pushRestrictions     `json:"restrictions"`
+}
+
+// branchProtectionResponse is the (differently-shaped) protection github
+// reports for a branch
+type branchProtectionResponse struct {
+	RequiredStatusChecks       *requiredStatusChecks `json:"required_status_checks"`
+	RequiredPullRequestReviews *requiredReviews      `json:"required_pull_request_reviews"`
+	EnforceAdmins              *struct {
+		Enabled bool `json:"enabled"`
+	} `json:"enforce_admins"`
+	Restrictions *struct {
+		Users []struct {
+			Login string `json:"login"`
+		} `json:"users"`
+		Teams []struct {
+			Slug string `json:"slug"`
+		} `json:"teams"`
+	} `json:"restrictions"`
+}
+
+// protection converts a response into the form used to update it
+func (r *branchProtectionResponse) protection() *BranchProtection {
+	bp := BranchProtection{
+		RequiredStatusChecks:       r.RequiredStatusChecks,
+		RequiredPullRequestReviews: r.RequiredPullRequestReviews,
+		EnforceAdmins:              r.EnforceAdmins != nil && r.EnforceAdmins.Enabled,
+	}
+
+	if r.Restrictions != nil {
+		bp.Restrictions = &pushRestrictions{Users: []string{}, Teams: []string{}}
+		for _, u := range r.Restrictions.Users {
+			bp.Restrictions.Users = append(bp.Restrictions.Users, u.Login)
+		}
+		for _, t := range r.Restrictions.Teams {
+			bp.Restrictions.Teams = append(bp.Restrictions.Teams, t.Slug)
+		}
+	}
+	return &bp
+}
+
+// sortedCopy returns a sorted, non-nil copy of a list
+func sortedCopy(list []string) []string {
+	sorted := append([]string{}, list...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+// normalized copies a protection, sorting its lists so that protections can
+// be compared
+func (bp BranchProtection) normalized() BranchProtection {
+	if bp.RequiredStatusChecks != nil {
+		checks := *bp.RequiredStatusChecks
+		checks.Contexts = sortedCopy(checks.Contexts)
+		bp.RequiredStatusChecks = &checks
+	}
+
+	if bp.RequiredPullRequestReviews != nil {
+		reviews := *bp.RequiredPullRequestReviews
+		if reviews.RequiredApprovingReviewCount == 0 {
+			// github's default
+			reviews.RequiredApprovingReviewCount = 1
+		}
+		bp.RequiredPullRequestReviews = &reviews
+	}
+
+	if bp.Restrictions != nil {
+		bp.Restrictions = &pushRestrictions{
+			Users: sortedCopy(bp.Restrictions.Users),
+			Teams: sortedCopy(bp.Restrictions.Teams),
+		}
+	}
+	return bp
+}
+
+// protectionMatches compares a branch's current protection with the desired
+// protection
+func protectionMatches(current, desired *BranchProtection) bool {
+	return reflect.DeepEqual(current.normalized(), desired.normalized())
+}
+
+type BranchProtectionService struct {
+	Client    *github.Client
+	RepoOwner string
+	RepoName  string
+	DryRun    bool
+}
+
+func NewBranchProtectionService(client *github.Client, owner, name string, dryRun bool) *BranchProtectionService {
+	return &BranchProtectionService{client, owner, name, dryRun}
+}
+
+// path locates the protection of branch in github's API
+func (bps *BranchProtectionService) path(branch string) string {
+	return fmt.Sprintf("repos/%s/%s/branches/%s/protection", bps.RepoOwner, bps.RepoName, branch)
+}
+
+// Get fetches the current protection of branch, or nil if it isn't protected
+func (bps *BranchProtectionService) Get(branch string) (*BranchProtection, error) {
+	req, err := bps.Client.NewRequest("GET", bps.path(branch), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", protectionPreview)
+
+	resp := branchProtectionResponse{}
+	if _, err := bps.Client.Do(req, &resp); err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return resp.protection(), nil
+}
+
+func (bps *BranchProtectionService) CreateOrUpdate(branch string, desired *BranchProtection) (*hubbub.Change, error) {
+	current, err := bps.Get(branch)
+	if err != nil {
+		return nil, err
+	}
+
+	change := hubbub.Change{Resource: branch, Action: hubbub.Update, After: desired}
+	if current == nil {
+		change.Action = hubbub.Create
+	} else {
+		change.Before = current
+		if protectionMatches(current, desired) {
+			change.Action = hubbub.Unchanged
+			return &change, nil
+		}
+	}
+
+	if bps.DryRun {
+		return &change, nil
+	}
+
+	req, err := bps.Client.NewRequest("PUT", bps.path(branch), desired)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", protectionPreview)
+
+	_, updateErr := bps.Client.Do(req, nil)
+	return &change, updateErr
+}
+
+func (bps *BranchProtectionService) Remove(branch string) (*hubbub.Change, error) {
+	current, err := bps.Get(branch)
+	if err != nil {
+		return nil, err
+	}
+
+	change := hubbub.Change{Resource: branch, Before: current}
+	if current == nil {
+		change.Action = hubbub.Unchanged
+		return &change, nil
+	}
+
+	change.Action = hubbub.Delete
+	if bps.DryRun {
+		return &change, nil
+	}
+
+	req, err := bps.Client.NewRequest("DELETE", bps.path(branch), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	_, deleteErr := bps.Client.Do(req, nil)
+	return &change, deleteErr
+}
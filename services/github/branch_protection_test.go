@@ -0,0 +1,59 @@
+package github_service
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestBranchProtectionResponseProtection(t *testing.T) {
+	resp := branchProtectionResponse{}
+	json.Unmarshal([]byte(`{
+		"required_status_checks": {"strict": true, "contexts": ["ci"]},
+		"enforce_admins": {"enabled": true},
+		"restrictions": {"users": [{"login": "rjz"}], "teams": [{"slug": "core"}]}
+	}`), &resp)
+
+	bp := resp.protection()
+	if !bp.EnforceAdmins || bp.RequiredPullRequestReviews != nil {
+		t.Error("unexpected protection", bp)
+	}
+
+	if bp.Restrictions.Users[0] != "rjz" || bp.Restrictions.Teams[0] != "core" {
+		t.Error("expected restrictions to be flattened, got", bp.Restrictions)
+	}
+}
+
+func TestProtectionMatches(t *testing.T) {
+	raw := json.RawMessage(`{
+		"state": "present",
+		"branch": "master",
+		"required_status_checks": {"strict": true, "contexts": ["ci", "lint"]},
+		"required_pull_request_reviews": {"dismiss_stale_reviews": true},
+		"restrictions": {"users": [], "teams": ["core"]}
+	}`)
+	params, err := parseBranchProtectionParams(&raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	current := BranchProtection{
+		RequiredStatusChecks:       &requiredStatusChecks{Strict: true, Contexts: []string{"lint", "ci"}},
+		RequiredPullRequestReviews: &requiredReviews{DismissStaleReviews: true, RequiredApprovingReviewCount: 1},
+		Restrictions:               &pushRestrictions{Teams: []string{"core"}},
+	}
+
+	if !protectionMatches(&current, &params.BranchProtection) {
+		t.Error("expected protection to match")
+	}
+
+	current.EnforceAdmins = true
+	if protectionMatches(&current, &params.BranchProtection) {
+		t.Error("expected admin enforcement to differ")
+	}
+
+	current.EnforceAdmins = false
+	current.RequiredPullRequestReviews = nil
+	if protectionMatches(&current, &params.BranchProtection) {
+		t.Error("expected missing review requirement to differ")
+	}
+}
@@ -0,0 +1,221 @@
+package github_service
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/google/go-github/github"
+	hubbub "github.com/rjz/hubbub/common"
+	"strings"
+)
+
+// deployKey is a deploy key as github represents it
+type deployKey struct {
+	ID       *int    `json:"id,omitempty"`
+	Title    *string `json:"title,omitempty"`
+	Key      *string `json:"key,omitempty"`
+	ReadOnly *bool   `json:"read_only,omitempty"`
+}
+
+// fingerprint computes the SHA256 fingerprint of an authorized_keys-style
+// public key (e.g. "ssh-rsa AAAA... comment"), the way `ssh-keygen -l` does
+func fingerprint(key string) (string, error) {
+	fields := strings.Fields(key)
+	if len(fields) < 2 {
+		return "", errors.New("invalid public key")
+	}
+
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("invalid public key: %s", err))
+	}
+
+	sum := sha256.Sum256(blob)
+	return fmt.Sprintf("SHA256:%s", base64.RawStdEncoding.EncodeToString(sum[:])), nil
+}
+
+// deployKeyMatches compares an existing key with the desired one
+func deployKeyMatches(existing, desired *deployKey) bool {
+	existingFingerprint, err := fingerprint(*existing.Key)
+	if err != nil {
+		return false
+	}
+
+	desiredFingerprint, err := fingerprint(*desired.Key)
+	if err != nil {
+		return false
+	}
+
+	existingReadOnly := existing.ReadOnly != nil && *existing.ReadOnly
+	desiredReadOnly := desired.ReadOnly != nil && *desired.ReadOnly
+	return *existing.Title == *desired.Title && existingFingerprint == desiredFingerprint && existingReadOnly == desiredReadOnly
+}
+
+type DeployKeyService struct {
+	Client    *github.Client
+	RepoOwner string
+	RepoName  string
+	Keys      *[]deployKey
+	DryRun    bool
+}
+
+func NewDeployKeyService(client *github.Client, owner, name string, dryRun bool) (*DeployKeyService, error) {
+	dks := DeployKeyService{client, owner, name, nil, dryRun}
+
+	var keys []deployKey
+	for page := 1; page != 0; {
+		req, err := client.NewRequest("GET", fmt.Sprintf("%s?per_page=100&page=%d", dks.path(nil), page), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var listed []deployKey
+		resp, err := client.Do(req, &listed)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, listed...)
+		page = resp.NextPage
+	}
+
+	dks.Keys = &keys
+	return &dks, nil
+}
+
+// path locates a key (or, if id is nil, all keys) in github's API
+func (dks *DeployKeyService) path(id *int) string {
+	path := fmt.Sprintf("repos/%s/%s/keys", dks.RepoOwner, dks.RepoName)
+	if id == nil {
+		return path
+	}
+	return fmt.Sprintf("%s/%d", path, *id)
+}
+
+// byTitle finds the existing key with title
+func (dks *DeployKeyService) byTitle(title string) *deployKey {
+	keys := *dks.Keys
+	for i, k := range keys {
+		if k.Title != nil && *k.Title == title {
+			return &keys[i]
+		}
+	}
+	return nil
+}
+
+// byTitleOrFingerprint finds the existing key with the desired key's title
+// or, failing that, with the same key material
+func (dks *DeployKeyService) byTitleOrFingerprint(desired *deployKey) (*deployKey, error) {
+	if k := dks.byTitle(*desired.Title); k != nil {
+		return k, nil
+	}
+
+	desiredFingerprint, err := fingerprint(*desired.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := *dks.Keys
+	for i, k := range keys {
+		if f, err := fingerprint(*k.Key); err == nil && f == desiredFingerprint {
+			return &keys[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (dks *DeployKeyService) create(key *deployKey) error {
+	req, err := dks.Client.NewRequest("POST", dks.path(nil), key)
+	if err != nil {
+		return err
+	}
+
+	created := deployKey{}
+	if _, err := dks.Client.Do(req, &created); err != nil {
+		return err
+	}
+
+	keys := append(*dks.Keys, created)
+	dks.Keys = &keys
+	return nil
+}
+
+func (dks *DeployKeyService) remove(key *deployKey) error {
+	req, err := dks.Client.NewRequest("DELETE", dks.path(key.ID), nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err := dks.Client.Do(req, nil); err != nil {
+		return err
+	}
+
+	var keys []deployKey
+	for _, k := range *dks.Keys {
+		if *k.ID != *key.ID {
+			keys = append(keys, k)
+		}
+	}
+	dks.Keys = &keys
+	return nil
+}
+
+// CreateOrUpdate adds a deploy key. Github doesn't allow keys to be edited,
+// so a key that differs is replaced.
+func (dks *DeployKeyService) CreateOrUpdate(desired *deployKey) (*hubbub.Change, error) {
+	existing, err := dks.byTitleOrFingerprint(desired)
+	if err != nil {
+		return nil, err
+	}
+
+	change := hubbub.Change{Resource: *desired.Title, After: desired}
+	if existing == nil {
+		change.Action = hubbub.Create
+		if dks.DryRun {
+			return &change, nil
+		}
+		return &change, dks.create(desired)
+	}
+
+	change.Before = *existing
+	if deployKeyMatches(existing, desired) {
+		change.Action = hubbub.Unchanged
+		return &change, nil
+	}
+
+	change.Action = hubbub.Update
+	if dks.DryRun {
+		return &change, nil
+	}
+
+	if err := dks.remove(existing); err != nil {
+		return &change, err
+	}
+	return &change, dks.create(desired)
+}
+
+// Remove deletes the key with the desired title (or, if the desired key
+// material is known, the same fingerprint)
+func (dks *DeployKeyService) Remove(desired *deployKey) (*hubbub.Change, error) {
+	existing := dks.byTitle(*desired.Title)
+	if existing == nil && desired.Key != nil {
+		var err error
+		if existing, err = dks.byTitleOrFingerprint(desired); err != nil {
+			return nil, err
+		}
+	}
+
+	change := hubbub.Change{Resource: *desired.Title}
+	if existing == nil {
+		change.Action = hubbub.Unchanged
+		return &change, nil
+	}
+
+	change.Action = hubbub.Delete
+	change.Before = *existing
+	if dks.DryRun {
+		return &change, nil
+	}
+	return &change, dks.remove(existing)
+}
@@ -0,0 +1,67 @@
+package github_service
+
+import (
+	"encoding/json"
+	hubbub "github.com/rjz/hubbub/common"
+	"testing"
+)
+
+const publicKeyFixture = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAILLTaHf9YRTYUELYBf6H9YHEV2xmmcvV9jFInCppXFg3"
+
+func TestFingerprint(t *testing.T) {
+	f, err := fingerprint(publicKeyFixture + " ci@example")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "SHA256:G1EsYTFT5tEmvZR7PeIB/635No1CC+MXtfYW1QY1qpk"; f != expected {
+		t.Error("expected", expected, "got", f)
+	}
+
+	if _, err := fingerprint("not a key"); err == nil {
+		t.Error("expected error for invalid key, didn't get it.")
+	}
+}
+
+func TestParseDeployKeyParamsKeyfile(t *testing.T) {
+	raw := json.RawMessage(`{"state":"present","title":"ci","keyfile":"__fixtures/deploy_key.pub"}`)
+	params, err := parseDeployKeyParams(&raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *params.Key != publicKeyFixture+" ci@example" {
+		t.Error("expected key to be loaded from keyfile, got", *params.Key)
+	}
+
+	raw = json.RawMessage(`{"state":"present","title":"ci","key":"ssh-ed25519 AAAA","keyfile":"__fixtures/deploy_key.pub"}`)
+	if _, err := parseDeployKeyParams(&raw); err == nil {
+		t.Error("expected error for ambiguous key, didn't get it.")
+	}
+}
+
+func TestDeployKeyServiceCreateOrUpdate(t *testing.T) {
+	dks := DeployKeyService{
+		DryRun: true,
+		Keys: &[]deployKey{
+			// github omits the comment
+			{ID: hubbub.Int(1), Title: hubbub.String("deploy"), Key: hubbub.String(publicKeyFixture), ReadOnly: hubbub.Bool(true)},
+		},
+	}
+
+	cases := map[*deployKey]hubbub.Action{
+		{Title: hubbub.String("deploy"), Key: hubbub.String(publicKeyFixture + " ci@example"), ReadOnly: hubbub.Bool(true)}: hubbub.Unchanged,
+		{Title: hubbub.String("deploy"), Key: hubbub.String(publicKeyFixture)}:                                              hubbub.Update,
+		{Title: hubbub.String("ci"), Key: hubbub.String(publicKeyFixture), ReadOnly: hubbub.Bool(true)}:                     hubbub.Update,
+	}
+
+	for desired, expected := range cases {
+		change, err := dks.CreateOrUpdate(desired)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if change.Action != expected {
+			t.Error("expected", expected, "for", *desired.Title, "got", change.Action)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package github_service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/go-github/github"
+	hubbub "github.com/rjz/hubbub/common"
+	"regexp"
+)
+
+// topicsPreview enables repository topics in github's API responses
+const topicsPreview = "application/vnd.github.mercy-preview+json"
+
+// sourceParams describe a "github_org" or "github_user" repository source
+type sourceParams struct {
+	Org             *string `json:"github_org,omitempty"`
+	User            *string `json:"github_user,omitempty"`
+	ExcludeArchived bool    `json:"exclude_archived,omitempty"`
+	ExcludeForks    bool    `json:"exclude_forks,omitempty"`
+	Topic           *string `json:"topic,omitempty"`
+	NamePattern     *string `json:"name_pattern,omitempty"`
+}
+
+func parseSourceParams(entry *json.RawMessage) (*sourceParams, error) {
+	params := sourceParams{}
+	if err := json.Unmarshal([]byte(*entry), &params); err != nil {
+		return nil, err
+	}
+
+	if (params.Org == nil) == (params.User == nil) {
+		return nil, errors.New("specify exactly one of github_org or github_user")
+	}
+
+	return &params, nil
+}
+
+// listedRepository is the subset of github's repository representation used
+// to filter sources
+type listedRepository struct {
+	Name     string   `json:"name"`
+	FullName string   `json:"full_name"`
+	Archived bool     `json:"archived"`
+	Fork     bool     `json:"fork"`
+	Topics   []string `json:"topics"`
+}
+
+// matches reports whether a listed repository satisfies the source's filters
+func (params *sourceParams) matches(r *listedRepository, namePattern *regexp.Regexp) bool {
+	if params.ExcludeArchived && r.Archived {
+		return false
+	}
+
+	if params.ExcludeForks && r.Fork {
+		return false
+	}
+
+	if namePattern != nil && !namePattern.MatchString(r.Name) {
+		return false
+	}
+
+	if params.Topic != nil {
+		for _, topic := range r.Topics {
+			if topic == *params.Topic {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// listRepositories fetches every repository owned by the source's
+// organization or user
+func listRepositories(client *github.Client, params *sourceParams) ([]listedRepository, error) {
+	path := ""
+	if params.Org != nil {
+		path = fmt.Sprintf("orgs/%s/repos", *params.Org)
+	} else {
+		path = fmt.Sprintf("users/%s/repos", *params.User)
+	}
+
+	var all []listedRepository
+	for page := 1; page != 0; {
+		req, err := client.NewRequest("GET", fmt.Sprintf("%s?per_page=100&page=%d", path, page), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", topicsPreview)
+
+		var repos []listedRepository
+		resp, err := client.Do(req, &repos)
+		if err != nil {
+			return nil, err
+		}
+
+		all = append(all, repos...)
+		page = resp.NextPage
+	}
+	return all, nil
+}
+
+// GithubRepositorySource expands a github organization or user into the
+// (filtered) list of repositories it owns
+func GithubRepositorySource(entry *json.RawMessage, facts *hubbub.Facts) ([]hubbub.Repository, error) {
+	params, err := parseSourceParams(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	var namePattern *regexp.Regexp
+	if params.NamePattern != nil {
+		if namePattern, err = regexp.Compile(*params.NamePattern); err != nil {
+			return nil, err
+		}
+	}
+
+	client, err := newClient(facts)
+	if err != nil {
+		return nil, err
+	}
+
+	listed, err := listRepositories(client, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var repos []hubbub.Repository
+	for i := range listed {
+		if params.matches(&listed[i], namePattern) {
+			repos = append(repos, hubbub.Repository{URL: fmt.Sprintf("github.com/%s", listed[i].FullName)})
+		}
+	}
+	return repos, nil
+}
+
+func init() {
+	hubbub.RegisterRepositorySource("github_org", GithubRepositorySource)
+	hubbub.RegisterRepositorySource("github_user", GithubRepositorySource)
+}
@@ -0,0 +1,39 @@
+package github_service
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+)
+
+func TestParseSourceParamsRequiresOneOwner(t *testing.T) {
+	for _, entry := range []string{`{}`, `{"github_org":"acme","github_user":"rjz"}`} {
+		raw := json.RawMessage(entry)
+		if _, err := parseSourceParams(&raw); err == nil {
+			t.Error("expected error for", entry)
+		}
+	}
+}
+
+func TestSourceParamsMatches(t *testing.T) {
+	raw := json.RawMessage(`{"github_org":"acme","exclude_archived":true,"topic":"service"}`)
+	params, err := parseSourceParams(&raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	namePattern := regexp.MustCompile("^api-")
+	cases := map[*listedRepository]bool{
+		&listedRepository{Name: "api-users", Topics: []string{"go", "service"}}:            true,
+		&listedRepository{Name: "api-users", Topics: []string{"go"}}:                       false,
+		&listedRepository{Name: "web-users", Topics: []string{"service"}}:                  false,
+		&listedRepository{Name: "api-legacy", Topics: []string{"service"}, Archived: true}: false,
+		&listedRepository{Name: "api-fork", Topics: []string{"service"}, Fork: true}:       true,
+	}
+
+	for r, expected := range cases {
+		if params.matches(r, namePattern) != expected {
+			t.Error("expected", expected, "for", *r)
+		}
+	}
+}
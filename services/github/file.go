@@ -1,12 +1,20 @@
 package github_service
 
 import (
+	"crypto/sha1"
 	"errors"
 	"fmt"
 	"github.com/google/go-github/github"
 	util "github.com/rjz/hubbub/common"
+	"path"
+	"sort"
 )
 
+// blobSHA computes the SHA git will assign to a blob with the given content
+func blobSHA(content string) string {
+	return fmt.Sprintf("%x", sha1.Sum([]byte(fmt.Sprintf("blob %d\x00%s", len(content), content))))
+}
+
 func findByPath(entries []github.TreeEntry, path string) *github.TreeEntry {
 	for _, entry := range entries {
 		if *entry.Path == path {
@@ -21,17 +29,27 @@ type FileService struct {
 	RepoOwner string
 	RepoName  string
 	RefTrees  map[sha]*github.Tree
+	DryRun    bool
+
+	// PullRequests opens pull requests for changes that are delivered by them
+	PullRequests *PullRequestService
+
+	// Batch stages changes to each ref until they're flushed, rather than
+	// committing each one as it's made
+	Batch  bool
+	stages map[string]*stage
 }
 
-func NewFileService(client *github.Client, owner, name string) *FileService {
-	fs := FileService{client, owner, name, make(map[sha]*github.Tree)}
+func NewFileService(client *github.Client, owner, name string, dryRun, batch bool) *FileService {
+	prs := NewPullRequestService(client, owner, name)
+	fs := FileService{client, owner, name, make(map[sha]*github.Tree), dryRun, prs, batch, make(map[string]*stage)}
 	return &fs
 }
 
-// RefFacts fetches the current state (SHA, tree) of the reference
+// TreeFacts fetches the (recursive) tree of the commit with SHA, so that
+// files can be found by their full paths
 func (fs *FileService) TreeFacts(SHA sha) error {
-	isRecursive := false // TODO: support recursive paths
-	tree, _, treeErr := fs.Client.Git.GetTree(fs.RepoOwner, fs.RepoName, string(SHA), isRecursive)
+	tree, _, treeErr := fs.Client.Git.GetTree(fs.RepoOwner, fs.RepoName, string(SHA), true)
 	if treeErr != nil {
 		return treeErr
 	}
@@ -40,89 +58,225 @@ func (fs *FileService) TreeFacts(SHA sha) error {
 	return nil
 }
 
-// CommitTree commits the provided tree
-func (fs *FileService) CommitTree(tree *github.Tree, refName, parentSHA, msg string) error {
+// parentDir returns the directory containing p, or "" for the root
+func parentDir(p string) string {
+	if dir := path.Dir(p); dir != "." {
+		return dir
+	}
+	return ""
+}
+
+// getTree fetches the entries directly within the tree with SHA
+var getTree = func(fs *FileService, SHA string) ([]github.TreeEntry, error) {
+	tree, _, err := fs.Client.Git.GetTree(fs.RepoOwner, fs.RepoName, SHA, false)
+	if err != nil {
+		return nil, err
+	}
+	return tree.Entries, nil
+}
+
+// createTree creates a tree on github, returning its SHA
+var createTree = func(fs *FileService, baseTree string, entries []github.TreeEntry) (*string, error) {
+	tree, _, err := fs.Client.Git.CreateTree(fs.RepoOwner, fs.RepoName, baseTree, entries)
+	if err != nil {
+		return nil, err
+	}
+	return tree.SHA, nil
+}
+
+// createCommit commits the tree with the provided SHA, returning the
+// commit's SHA
+func (fs *FileService) createCommit(treeSHA *string, parentSHA, msg string) (*string, error) {
 	commit, _, cErr := fs.Client.Git.CreateCommit(fs.RepoOwner, fs.RepoName, &github.Commit{
 		Message: &msg,
-		Tree:    &github.Tree{SHA: tree.SHA},
+		Tree:    &github.Tree{SHA: treeSHA},
 		Parents: []github.Commit{{SHA: &parentSHA}},
 	})
 	if cErr != nil {
-		return cErr
+		return nil, cErr
 	}
+	return commit.SHA, nil
+}
 
+// updateRef points refName at the commit with the provided SHA
+func (fs *FileService) updateRef(refName string, commitSHA *string, force bool) error {
 	newRef := github.Reference{
 		Ref:    &refName,
-		Object: &github.GitObject{SHA: commit.SHA},
+		Object: &github.GitObject{SHA: commitSHA},
 	}
-	_, _, err := fs.Client.Git.UpdateRef(fs.RepoOwner, fs.RepoName, &newRef, false)
+	_, _, err := fs.Client.Git.UpdateRef(fs.RepoOwner, fs.RepoName, &newRef, force)
 	return err
 }
 
-// CreateOrUpdate updates an existing file or creates it if it does not exist.
-// The new file conforms to the specified params.
-func (fs *FileService) CreateOrUpdate(parentSHA sha, params fileParams) error {
-	if fs.RefTrees[parentSHA] == nil {
-		return errors.New(fmt.Sprintf("No tree available for SHA '%s'", parentSHA))
+// resetBranch points refName at the commit with the provided SHA, creating
+// the branch if it doesn't exist and discarding anything already on it if it
+// does
+func (fs *FileService) resetBranch(refName string, commitSHA *string) error {
+	if _, _, err := fs.Client.Git.GetRef(fs.RepoOwner, fs.RepoName, refName); err == nil {
+		return fs.updateRef(refName, commitSHA, true)
+	} else if !isNotFound(err) {
+		return err
 	}
 
-	existingTree := fs.RefTrees[parentSHA]
-	existingTreeEntries := existingTree.Entries
-	filepath := *params.Name
-	newEntries := append(existingTreeEntries, github.TreeEntry{
-		Path:    &filepath,
-		Mode:    util.String("100644"),
-		Type:    util.String("blob"),
-		Content: params.Content,
-	})
+	newRef := github.Reference{
+		Ref:    &refName,
+		Object: &github.GitObject{SHA: commitSHA},
+	}
+	_, _, err := fs.Client.Git.CreateRef(fs.RepoOwner, fs.RepoName, &newRef)
+	return err
+}
 
-	sha := existingTree.SHA // this might be wrong..
-	// Create a new tree including the updated file to obtain a SHA
-	newTree, _, tErr := fs.Client.Git.CreateTree(fs.RepoOwner, fs.RepoName, *sha, newEntries)
-	if tErr != nil {
-		return tErr
+// CommitTree commits the tree with the provided SHA
+func (fs *FileService) CommitTree(treeSHA *string, refName, parentSHA, msg string) error {
+	commitSHA, err := fs.createCommit(treeSHA, parentSHA, msg)
+	if err != nil {
+		return err
 	}
+	return fs.updateRef(refName, commitSHA, false)
+}
 
-	// Compare old and new SHAs to decide whether to update
-	oldEntry := findByPath(existingTreeEntries, filepath)
-	newEntry := findByPath(newTree.Entries, filepath)
-	if oldEntry != nil {
-		if *oldEntry.SHA == *newEntry.SHA {
-			// nothing updated / nothing to do.
-			return nil
-		}
+// deliver commits the tree with the provided SHA to a pull request's branch
+// and opens the pull request. Without an open pull request, the branch is
+// reset so that stale changes aren't proposed again.
+func (fs *FileService) deliver(treeSHA *string, st *stage) error {
+	commitSHA, err := fs.createCommit(treeSHA, string(st.parentSHA), st.message())
+	if err != nil {
+		return err
 	}
 
-	return fs.CommitTree(newTree, *params.Ref, string(parentSHA), fmt.Sprintf("Adding '%s'", filepath))
+	existing, err := fs.PullRequests.Find(st.pullRequest)
+	if err != nil {
+		return err
+	}
+
+	if existing != nil {
+		err = fs.updateRef(st.ref, commitSHA, false)
+	} else {
+		err = fs.resetBranch(st.ref, commitSHA)
+	}
+	if err != nil {
+		return err
+	}
+	return fs.PullRequests.Open(st.pullRequest, existing)
 }
 
-// Remove attempts to delete a file from the parent SHA
-func (fs *FileService) Remove(parentSHA sha, params fileParams) error {
+// IsStaged reports whether changes to ref are waiting to be flushed
+func (fs *FileService) IsStaged(refName string) bool {
+	return fs.stages[refName] != nil
+}
+
+// stageFor returns the stage collecting changes to the file described by
+// params. Outside of batch mode, each change gets a stage of its own.
+func (fs *FileService) stageFor(parentSHA sha, params fileParams) (*stage, error) {
+	refName, pr := params.target(), params.pullRequest()
+	if st := fs.stages[refName]; st != nil {
+		if pr != nil && (st.pullRequest == nil || !st.pullRequest.matches(pr)) {
+			return nil, errors.New(fmt.Sprintf("Conflicting pull requests for '%s'", refName))
+		}
+		return st, nil
+	}
+
 	if fs.RefTrees[parentSHA] == nil {
-		return errors.New(fmt.Sprintf("No tree available for sha '%s'", parentSHA))
+		return nil, errors.New(fmt.Sprintf("No tree available for SHA '%s'", parentSHA))
 	}
+	return newStage(refName, parentSHA, fs.RefTrees[parentSHA], pr), nil
+}
 
-	existingTree := fs.RefTrees[parentSHA]
-	existingTreeEntries := existingTree.Entries
-	filepath := *params.Name
-	oldEntry := findByPath(existingTreeEntries, filepath)
-	if oldEntry == nil {
+// commit builds and commits a stage's changes
+func (fs *FileService) commit(st *stage) error {
+	if fs.DryRun || st.isEmpty() {
 		return nil
 	}
 
-	newEntries := []github.TreeEntry{}
-	for _, e := range existingTreeEntries {
-		if *e.Path != filepath {
-			newEntries = append(newEntries, e)
+	treeSHA, err := st.build(fs)
+	if err != nil {
+		return err
+	}
+
+	if st.pullRequest != nil {
+		return fs.deliver(treeSHA, st)
+	}
+	return fs.CommitTree(treeSHA, st.ref, string(st.parentSHA), st.message())
+}
+
+// stageChange adds a change to a stage, committing it right away unless
+// changes are being batched
+func (fs *FileService) stageChange(st *stage, f stagedFile, msg string) error {
+	st.add(f, msg)
+	if fs.Batch {
+		fs.stages[st.ref] = st
+		return nil
+	}
+	return fs.commit(st)
+}
+
+// Flush commits the changes staged for each ref in batch mode
+func (fs *FileService) Flush() error {
+	var refs []string
+	for ref := range fs.stages {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+
+	for _, ref := range refs {
+		st := fs.stages[ref]
+		delete(fs.stages, ref)
+		if err := fs.commit(st); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
-	// Create a new tree including the updated file to obtain a SHA
-	sha := existingTree.SHA // this might be wrong..
-	newTree, _, tErr := fs.Client.Git.CreateTree(fs.RepoOwner, fs.RepoName, *sha, newEntries)
-	if tErr != nil {
-		return tErr
+// CreateOrUpdate updates an existing file or creates it if it does not exist.
+// The new file conforms to the specified params.
+func (fs *FileService) CreateOrUpdate(parentSHA sha, params fileParams) (*util.Change, error) {
+	return fs.put(parentSHA, params, fmt.Sprintf("Adding '%s'", *params.Name))
+}
+
+// put stages the file described by params (if it differs from the existing
+// file), describing the change with msg
+func (fs *FileService) put(parentSHA sha, params fileParams, msg string) (*util.Change, error) {
+	st, err := fs.stageFor(parentSHA, params)
+	if err != nil {
+		return nil, err
+	}
+
+	filepath := *params.Name
+	change := util.Change{Resource: filepath, Action: util.Create, After: blobSHA(*params.Content)}
+
+	// Compare old and new SHAs to decide whether to update
+	mode := util.String("100644")
+	if oldEntry := st.lookup(filepath); oldEntry != nil {
+		mode = oldEntry.Mode
+		change.Before = *oldEntry.SHA
+		if *oldEntry.SHA == change.After {
+			// nothing updated / nothing to do.
+			change.Action = util.Unchanged
+			return &change, nil
+		}
+		change.Action = util.Update
+	}
+
+	f := stagedFile{Path: filepath, Mode: mode, Content: params.Content}
+	return &change, fs.stageChange(st, f, msg)
+}
+
+// Remove attempts to delete a file from the parent SHA
+func (fs *FileService) Remove(parentSHA sha, params fileParams) (*util.Change, error) {
+	st, err := fs.stageFor(parentSHA, params)
+	if err != nil {
+		return nil, err
+	}
+
+	filepath := *params.Name
+	change := util.Change{Resource: filepath, Action: util.Unchanged}
+	oldEntry := st.lookup(filepath)
+	if oldEntry == nil {
+		return &change, nil
 	}
 
-	return fs.CommitTree(newTree, *params.Ref, string(parentSHA), fmt.Sprintf("Adding '%s'", filepath))
+	change.Action = util.Delete
+	change.Before = *oldEntry.SHA
+	return &change, fs.stageChange(st, stagedFile{Path: filepath}, fmt.Sprintf("Removing '%s'", filepath))
 }
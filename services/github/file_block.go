@@ -0,0 +1,196 @@
+package github_service
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	util "github.com/rjz/hubbub/common"
+	"strings"
+)
+
+const (
+	defaultBeginMarker = "# BEGIN hubbub"
+	defaultEndMarker   = "# END hubbub"
+)
+
+// fileBlockParams describe a "github_file_block" goal
+type fileBlockParams struct {
+	fileParams
+	BeginMarker string `json:"begin_marker,omitempty"`
+	EndMarker   string `json:"end_marker,omitempty"`
+}
+
+// withNewline ends s with a newline, if it doesn't already
+func withNewline(s string) string {
+	if s == "" || strings.HasSuffix(s, "\n") {
+		return s
+	}
+	return s + "\n"
+}
+
+// lineEnding is the line ending used by content: "\r\n" if any of its lines
+// end that way, "\n" otherwise
+func lineEnding(content string) string {
+	if strings.Contains(content, "\r\n") {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// withLineEnding rewrites s's line endings as eol
+func withLineEnding(s, eol string) string {
+	return strings.Replace(strings.Replace(s, "\r\n", "\n", -1), "\n", eol, -1)
+}
+
+// blockBounds are the offsets of a block within a file
+type blockBounds struct {
+	// start and stop surround the block, including its markers
+	start, stop int
+
+	// innerStart and innerStop surround the lines between the markers
+	innerStart, innerStop int
+}
+
+// findBlock locates the lines marking a block within content, returning nil
+// if the block isn't found. A begin marker without an end marker is an error.
+func findBlock(content, begin, end string) (*blockBounds, error) {
+	var b *blockBounds
+	offset := 0
+	for _, line := range strings.SplitAfter(content, "\n") {
+		trimmed := strings.TrimRight(line, " \t\r\n")
+		switch {
+		case b == nil && trimmed == begin:
+			b = &blockBounds{start: offset, innerStart: offset + len(line)}
+		case b != nil && trimmed == end:
+			b.innerStop, b.stop = offset, offset+len(line)
+			return b, nil
+		}
+		offset += len(line)
+	}
+
+	if b != nil {
+		return nil, errors.New(fmt.Sprintf("Unterminated block: found '%s' without '%s'", begin, end))
+	}
+	return nil, nil
+}
+
+// replaceBlock replaces the block between the begin and end markers in
+// content, returning the updated content and the block's previous contents
+// (or nil, if content didn't contain it). A nil block removes the block and
+// its markers; a block that isn't found is appended. The block is written with
+// content's line endings, and its previous contents are returned with "\n".
+func replaceBlock(content, begin, end string, block *string) (string, *string, error) {
+	eol := lineEnding(content)
+	var replacement string
+	if block != nil {
+		replacement = withLineEnding(fmt.Sprintf("%s\n%s%s\n", begin, withNewline(*block), end), eol)
+	}
+
+	b, err := findBlock(content, begin, end)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if b == nil {
+		if block == nil {
+			return content, nil, nil
+		}
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += eol
+		}
+		return content + replacement, nil, nil
+	}
+
+	existing := withLineEnding(content[b.innerStart:b.innerStop], "\n")
+	return content[:b.start] + replacement + content[b.stop:], &existing, nil
+}
+
+// getBlob fetches the content of the blob with SHA from github
+var getBlob = func(fs *FileService, SHA string) (string, error) {
+	blob, _, err := fs.Client.Git.GetBlob(fs.RepoOwner, fs.RepoName, SHA)
+	if err != nil {
+		return "", err
+	}
+
+	if blob.Encoding == nil || *blob.Encoding != "base64" {
+		return *blob.Content, nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.Replace(*blob.Content, "\n", "", -1))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// readFile fetches the content of the file described by params, taking staged
+// changes into account. It returns nil if the file doesn't exist.
+func (fs *FileService) readFile(parentSHA sha, params fileParams) (*string, error) {
+	st, err := fs.stageFor(parentSHA, params)
+	if err != nil {
+		return nil, err
+	}
+
+	if f, ok := st.files[*params.Name]; ok {
+		return f.Content, nil
+	}
+
+	entry := st.lookup(*params.Name)
+	if entry == nil {
+		return nil, nil
+	}
+
+	content, err := getBlob(fs, *entry.SHA)
+	if err != nil {
+		return nil, err
+	}
+	return &content, nil
+}
+
+// ApplyBlock adds, updates or removes the block between params' markers,
+// leaving the rest of the file untouched
+func (fs *FileService) ApplyBlock(parentSHA sha, params fileBlockParams) (*util.Change, error) {
+	current, err := fs.readFile(parentSHA, params.fileParams)
+	if err != nil {
+		return nil, err
+	}
+
+	content := ""
+	if current != nil {
+		content = *current
+	}
+
+	var block *string
+	if *params.State == "present" {
+		block = util.String(withNewline(*params.Content))
+	}
+
+	updated, existing, err := replaceBlock(content, params.BeginMarker, params.EndMarker, block)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("%s: %s", *params.Name, err))
+	}
+
+	change := util.Change{Resource: *params.Name, Action: util.Unchanged}
+	switch {
+	case existing != nil && block == nil:
+		change.Action = util.Delete
+		change.Before = *existing
+	case existing != nil:
+		change.Before = *existing
+		change.After = *block
+		if *existing != *block {
+			change.Action = util.Update
+		}
+	case block != nil:
+		change.Action = util.Create
+		change.After = *block
+	}
+
+	if !change.IsChanged() {
+		return &change, nil
+	}
+
+	params.Content = &updated
+	_, err = fs.put(parentSHA, params.fileParams, fmt.Sprintf("Updating managed block in '%s'", *params.Name))
+	return &change, err
+}
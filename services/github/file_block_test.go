@@ -0,0 +1,177 @@
+package github_service
+
+import (
+	"encoding/json"
+	"github.com/google/go-github/github"
+	hubbub "github.com/rjz/hubbub/common"
+	"testing"
+)
+
+const gitignore = "node_modules\n# BEGIN hubbub\nnpm-debug.log\n# END hubbub\n.env\n"
+
+func TestReplaceBlock(t *testing.T) {
+	examples := []struct {
+		content  string
+		block    *string
+		expected string
+		existing *string
+	}{
+		// appended to a file without the block
+		{"node_modules", hubbub.String("npm-debug.log\n"), "node_modules\n# BEGIN hubbub\nnpm-debug.log\n# END hubbub\n", nil},
+		{"", hubbub.String("npm-debug.log\n"), "# BEGIN hubbub\nnpm-debug.log\n# END hubbub\n", nil},
+		// replaced in place
+		{gitignore, hubbub.String("humans.txt\n"), "node_modules\n# BEGIN hubbub\nhumans.txt\n# END hubbub\n.env\n", hubbub.String("npm-debug.log\n")},
+		// removed along with its markers
+		{gitignore, nil, "node_modules\n.env\n", hubbub.String("npm-debug.log\n")},
+		{"node_modules\n", nil, "node_modules\n", nil},
+		// written with the file's line endings
+		{"node_modules\r\n", hubbub.String("npm-debug.log\n"), "node_modules\r\n# BEGIN hubbub\r\nnpm-debug.log\r\n# END hubbub\r\n", nil},
+		{"node_modules\r\n# BEGIN hubbub\r\nnpm-debug.log\r\n# END hubbub\r\n.env\r\n", hubbub.String("npm-debug.log\n"), "node_modules\r\n# BEGIN hubbub\r\nnpm-debug.log\r\n# END hubbub\r\n.env\r\n", hubbub.String("npm-debug.log\n")},
+	}
+
+	for _, ex := range examples {
+		updated, existing, err := replaceBlock(ex.content, defaultBeginMarker, defaultEndMarker, ex.block)
+		if err != nil {
+			t.Error(err)
+		}
+
+		if updated != ex.expected {
+			t.Errorf("expected %q, got %q", ex.expected, updated)
+		}
+
+		if (existing == nil) != (ex.existing == nil) || (existing != nil && *existing != *ex.existing) {
+			t.Errorf("expected existing block %v, got %v", ex.existing, existing)
+		}
+	}
+}
+
+func TestReplaceBlockCustomMarkers(t *testing.T) {
+	content := "all: build\n\n## hubbub {\nlint:\n\tgolint ./...\n## }\n"
+	updated, existing, err := replaceBlock(content, "## hubbub {", "## }", hubbub.String("lint:\n\tgo vet ./..."))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *existing != "lint:\n\tgolint ./...\n" {
+		t.Errorf("expected existing block, got %q", *existing)
+	}
+
+	if updated != "all: build\n\n## hubbub {\nlint:\n\tgo vet ./...\n## }\n" {
+		t.Errorf("expected block to be replaced, got %q", updated)
+	}
+}
+
+func TestReplaceBlockUnterminated(t *testing.T) {
+	content := "node_modules\n# BEGIN hubbub\nnpm-debug.log\n.env\n"
+	for _, block := range []*string{hubbub.String("humans.txt\n"), nil} {
+		if updated, _, err := replaceBlock(content, defaultBeginMarker, defaultEndMarker, block); err == nil {
+			t.Errorf("expected unterminated block to fail, got %q", updated)
+		}
+	}
+}
+
+// stubBlobs replaces getBlob with a fake that serves content by SHA
+func stubBlobs(blobs map[string]string) func() {
+	original := getBlob
+	getBlob = func(fs *FileService, SHA string) (string, error) {
+		return blobs[SHA], nil
+	}
+	return func() { getBlob = original }
+}
+
+func TestFileServiceApplyBlock(t *testing.T) {
+	defer stubBlobs(map[string]string{blobSHA(gitignore): gitignore})()
+
+	tree := &github.Tree{SHA: hubbub.String("root"), Entries: []github.TreeEntry{treeEntry(".gitignore", "blob", blobSHA(gitignore))}}
+	fs := NewFileService(nil, "rjz", "uno", true, true)
+	fs.RefTrees["parent"] = tree
+
+	raw := json.RawMessage(`{"state": "present", "ref": "heads/master", "name": ".gitignore", "content": "npm-debug.log"}`)
+	params, err := parseFileBlockParams(&raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	change, err := fs.ApplyBlock("parent", *params)
+	if err != nil || change.Action != hubbub.Unchanged {
+		t.Error("expected block to be unchanged, got", change, err)
+	}
+
+	params.Content = hubbub.String("humans.txt")
+	change, err = fs.ApplyBlock("parent", *params)
+	if err != nil || change.Action != hubbub.Update {
+		t.Error("expected block to be updated, got", change, err)
+	}
+
+	// the staged file keeps everything outside of the block
+	staged, err := fs.readFile("", params.fileParams)
+	if err != nil || *staged != "node_modules\n# BEGIN hubbub\nhumans.txt\n# END hubbub\n.env\n" {
+		t.Errorf("expected staged file to be updated, got %q (%v)", *staged, err)
+	}
+
+	params.State = hubbub.String("absent")
+	change, err = fs.ApplyBlock("", *params)
+	if err != nil || change.Action != hubbub.Delete {
+		t.Error("expected block to be removed, got", change, err)
+	}
+}
+
+func TestFileServiceApplyBlockNewFile(t *testing.T) {
+	fs := NewFileService(nil, "rjz", "uno", true, false)
+	fs.RefTrees["parent"] = treeFixture
+
+	params := fileBlockParams{
+		fileParams: fileParams{
+			State:   hubbub.String("present"),
+			Name:    hubbub.String("Makefile"),
+			Content: hubbub.String("lint:\n\tgo vet ./..."),
+			Ref:     hubbub.String("heads/master"),
+		},
+		BeginMarker: defaultBeginMarker,
+		EndMarker:   defaultEndMarker,
+	}
+	change, err := fs.ApplyBlock("parent", params)
+	if err != nil || change.Action != hubbub.Create {
+		t.Error("expected block to be created, got", change, err)
+	}
+
+	params.State = hubbub.String("absent")
+	change, err = fs.ApplyBlock("parent", params)
+	if err != nil || change.Action != hubbub.Unchanged {
+		t.Error("expected missing block to be unchanged, got", change, err)
+	}
+}
+
+func TestParseFileBlockParamsMarkers(t *testing.T) {
+	raw := json.RawMessage(`{"state": "present", "ref": "heads/master", "name": "Makefile", "content": "", "begin_marker": "##", "end_marker": "##"}`)
+	if _, err := parseFileBlockParams(&raw); err == nil {
+		t.Error("expected identical markers to be ambiguous")
+	}
+}
+
+func TestFileServiceApplyBlockUnterminated(t *testing.T) {
+	content := "node_modules\n# BEGIN hubbub\nnpm-debug.log\n"
+	defer stubBlobs(map[string]string{blobSHA(content): content})()
+
+	tree := &github.Tree{SHA: hubbub.String("root"), Entries: []github.TreeEntry{treeEntry(".gitignore", "blob", blobSHA(content))}}
+	fs := NewFileService(nil, "rjz", "uno", true, true)
+	fs.RefTrees["parent"] = tree
+
+	params := fileBlockParams{
+		fileParams: fileParams{
+			State:   hubbub.String("present"),
+			Name:    hubbub.String(".gitignore"),
+			Content: hubbub.String("npm-debug.log"),
+			Ref:     hubbub.String("heads/master"),
+		},
+		BeginMarker: defaultBeginMarker,
+		EndMarker:   defaultEndMarker,
+	}
+	if change, err := fs.ApplyBlock("parent", params); err == nil {
+		t.Error("expected unterminated block to fail, got", change)
+	}
+
+	if fs.IsStaged("heads/master") {
+		t.Error("expected nothing to be staged")
+	}
+}
@@ -0,0 +1,325 @@
+package github_service
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/google/go-github/github"
+	hubbub "github.com/rjz/hubbub/common"
+	"path"
+	"testing"
+)
+
+func treeEntry(path, kind, SHA string) github.TreeEntry {
+	mode := "100644"
+	if kind == "tree" {
+		mode = "040000"
+	}
+	return github.TreeEntry{Path: hubbub.String(path), Mode: hubbub.String(mode), Type: hubbub.String(kind), SHA: hubbub.String(SHA)}
+}
+
+// treeFixture is a recursive tree, as github reports it
+var treeFixture = &github.Tree{
+	SHA: hubbub.String("root"),
+	Entries: []github.TreeEntry{
+		treeEntry("README.md", "blob", blobSHA("hello")),
+		treeEntry(".github", "tree", "gh"),
+		treeEntry(".github/workflows", "tree", "wf"),
+		treeEntry(".github/workflows/ci.yml", "blob", "ci"),
+		treeEntry(".github/workflows/lint.yml", "blob", "lint"),
+		treeEntry("docs", "tree", "docs"),
+		treeEntry("docs/CONTRIBUTING.md", "blob", "contributing"),
+	},
+}
+
+// createdTree records a call to createTree
+type createdTree struct {
+	base    string
+	entries []string
+}
+
+// listings serves the entries directly within each directory of a recursive
+// tree, by SHA
+func listings(tree *github.Tree) map[string][]github.TreeEntry {
+	dirs := map[string]string{"": *tree.SHA}
+	for _, e := range tree.Entries {
+		if *e.Type == "tree" {
+			dirs[*e.Path] = *e.SHA
+		}
+	}
+
+	listed := map[string][]github.TreeEntry{}
+	for _, e := range tree.Entries {
+		SHA := dirs[parentDir(*e.Path)]
+		listed[SHA] = append(listed[SHA], treeEntry(path.Base(*e.Path), *e.Type, *e.SHA))
+	}
+	return listed
+}
+
+// stubListings replaces getTree with a fake that lists the directories of
+// tree one level at a time
+func stubListings(tree *github.Tree) func() {
+	listed := listings(tree)
+	original := getTree
+	getTree = func(fs *FileService, SHA string) ([]github.TreeEntry, error) {
+		return listed[SHA], nil
+	}
+	return func() { getTree = original }
+}
+
+// recordTrees replaces createTree with a fake that records the trees created,
+// and lists existing directories from treeFixture
+func recordTrees() (*[]createdTree, func()) {
+	var created []createdTree
+	restoreListings := stubListings(treeFixture)
+	original := createTree
+	createTree = func(fs *FileService, baseTree string, entries []github.TreeEntry) (*string, error) {
+		ct := createdTree{base: baseTree}
+		for _, e := range entries {
+			value := e.SHA
+			if value == nil {
+				value = e.Content
+			}
+			ct.entries = append(ct.entries, fmt.Sprintf("%s:%s", *e.Path, *value))
+		}
+		created = append(created, ct)
+		return hubbub.String(fmt.Sprintf("new%d", len(created))), nil
+	}
+	return &created, func() {
+		createTree = original
+		restoreListings()
+	}
+}
+
+// buildWithout builds the fixture tree less the file at filepath
+func buildWithout(filepath string) (*string, error) {
+	st := newStage("heads/master", "parent", treeFixture, nil)
+	st.add(stagedFile{Path: filepath}, fmt.Sprintf("Removing '%s'", filepath))
+	return st.build(NewFileService(nil, "rjz", "uno", false, false))
+}
+
+func TestStageRemovesNestedFile(t *testing.T) {
+	created, restore := recordTrees()
+	defer restore()
+
+	newSHA, err := buildWithout(".github/workflows/ci.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := fmt.Sprint([]createdTree{
+		{"", []string{"lint.yml:lint"}},
+		{"gh", []string{"workflows:new1"}},
+		{"root", []string{".github:new2"}},
+	})
+	if fmt.Sprint(*created) != expected {
+		t.Error("expected", expected, "got", *created)
+	}
+
+	if *newSHA != "new3" {
+		t.Error("expected new root tree, got", *newSHA)
+	}
+}
+
+func TestStageRemovesEmptyDirectories(t *testing.T) {
+	created, restore := recordTrees()
+	defer restore()
+
+	if _, err := buildWithout("docs/CONTRIBUTING.md"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := fmt.Sprint([]createdTree{
+		{"", []string{"README.md:" + blobSHA("hello"), ".github:gh"}},
+	})
+	if fmt.Sprint(*created) != expected {
+		t.Error("expected", expected, "got", *created)
+	}
+}
+
+func TestStageIgnoresTruncatedListing(t *testing.T) {
+	created, restore := recordTrees()
+	defer restore()
+
+	// github left the rest of .github/workflows out of the recursive listing
+	truncated := &github.Tree{SHA: treeFixture.SHA, Entries: treeFixture.Entries[:4]}
+	st := newStage("heads/master", "parent", truncated, nil)
+	st.add(stagedFile{Path: ".github/workflows/ci.yml"}, "Removing '.github/workflows/ci.yml'")
+	if _, err := st.build(NewFileService(nil, "rjz", "uno", false, false)); err != nil {
+		t.Fatal(err)
+	}
+
+	if entries := (*created)[0].entries; len(entries) != 1 || entries[0] != "lint.yml:lint" {
+		t.Error("expected lint.yml to be kept, got", entries)
+	}
+}
+
+func TestStageAddsAndRemovesFiles(t *testing.T) {
+	created, restore := recordTrees()
+	defer restore()
+
+	st := newStage("heads/master", "parent", treeFixture, nil)
+	st.add(stagedFile{Path: ".github/workflows/ci.yml", Mode: hubbub.String("100644"), Content: hubbub.String("on: push")}, "Adding '.github/workflows/ci.yml'")
+	st.add(stagedFile{Path: "docs/CONTRIBUTING.md"}, "Removing 'docs/CONTRIBUTING.md'")
+	st.add(stagedFile{Path: "NEW.md", Mode: hubbub.String("100644"), Content: hubbub.String("hi")}, "Adding 'NEW.md'")
+
+	newSHA, err := st.build(NewFileService(nil, "rjz", "uno", false, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := fmt.Sprint([]createdTree{
+		{"wf", []string{"ci.yml:on: push"}},
+		{"gh", []string{"workflows:new1"}},
+		{"", []string{"README.md:" + blobSHA("hello"), ".github:new2", "NEW.md:hi"}},
+	})
+	if fmt.Sprint(*created) != expected {
+		t.Error("expected", expected, "got", *created)
+	}
+
+	if *newSHA != "new3" {
+		t.Error("expected new root tree, got", *newSHA)
+	}
+
+	message := "Updating 3 files\n\nAdding '.github/workflows/ci.yml'\nRemoving 'docs/CONTRIBUTING.md'\nAdding 'NEW.md'"
+	if st.message() != message {
+		t.Error("expected combined message, got", st.message())
+	}
+}
+
+func TestStageWithoutRemovalsBuildsOnRoot(t *testing.T) {
+	created, restore := recordTrees()
+	defer restore()
+
+	st := newStage("heads/master", "parent", treeFixture, nil)
+	st.add(stagedFile{Path: "a/b.md", Mode: hubbub.String("100644"), Content: hubbub.String("b")}, "Adding 'a/b.md'")
+	st.add(stagedFile{Path: "c.md", Mode: hubbub.String("100644"), Content: hubbub.String("c")}, "Adding 'c.md'")
+	if _, err := st.build(NewFileService(nil, "rjz", "uno", false, true)); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := fmt.Sprint([]createdTree{{"root", []string{"a/b.md:b", "c.md:c"}}})
+	if fmt.Sprint(*created) != expected {
+		t.Error("expected", expected, "got", *created)
+	}
+}
+
+func TestFileServiceBatchesChanges(t *testing.T) {
+	fs := NewFileService(nil, "rjz", "uno", true, true)
+	fs.RefTrees["parent"] = treeFixture
+	ref := hubbub.String("heads/master")
+
+	change, err := fs.CreateOrUpdate("parent", fileParams{Name: hubbub.String("NEW.md"), Content: hubbub.String("hi"), Ref: ref})
+	if err != nil || change.Action != hubbub.Create {
+		t.Error("expected NEW.md to be created, got", change, err)
+	}
+
+	if !fs.IsStaged("heads/master") {
+		t.Fatal("expected change to be staged")
+	}
+
+	// later goals see the staged content, without needing the parent tree
+	change, err = fs.CreateOrUpdate("", fileParams{Name: hubbub.String("NEW.md"), Content: hubbub.String("hi"), Ref: ref})
+	if err != nil || change.Action != hubbub.Unchanged {
+		t.Error("expected staged NEW.md to be unchanged, got", change, err)
+	}
+
+	change, err = fs.Remove("", fileParams{Name: hubbub.String("NEW.md"), Ref: ref})
+	if err != nil || change.Action != hubbub.Delete {
+		t.Error("expected staged NEW.md to be removed, got", change, err)
+	}
+
+	if err := fs.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if fs.IsStaged("heads/master") {
+		t.Error("expected flush to clear staged changes")
+	}
+}
+
+func TestFileServiceNestedPaths(t *testing.T) {
+	fs := NewFileService(nil, "rjz", "uno", true, false)
+	fs.RefTrees["parent"] = treeFixture
+
+	change, err := fs.CreateOrUpdate("parent", fileParams{Name: hubbub.String("README.md"), Content: hubbub.String("hello"), Ref: hubbub.String("heads/master")})
+	if err != nil || change.Action != hubbub.Unchanged {
+		t.Error("expected README.md to be unchanged, got", change, err)
+	}
+
+	change, err = fs.CreateOrUpdate("parent", fileParams{Name: hubbub.String(".github/workflows/ci.yml"), Content: hubbub.String("on: push"), Ref: hubbub.String("heads/master")})
+	if err != nil || change.Action != hubbub.Update {
+		t.Error("expected nested file to be updated, got", change, err)
+	}
+
+	change, err = fs.Remove("parent", fileParams{Name: hubbub.String("docs/CONTRIBUTING.md"), Ref: hubbub.String("heads/master")})
+	if err != nil || change.Action != hubbub.Delete {
+		t.Error("expected nested file to be removed, got", change, err)
+	}
+}
+
+func TestFileServicePullRequests(t *testing.T) {
+	fs := NewFileService(nil, "rjz", "uno", true, true)
+	fs.RefTrees["parent"] = treeFixture
+
+	params := fileParams{
+		Name:        hubbub.String("NEW.md"),
+		Content:     hubbub.String("hi"),
+		Ref:         hubbub.String("heads/master"),
+		PullRequest: &pullRequestParams{Labels: []string{"hubbub"}},
+	}
+	if _, err := fs.CreateOrUpdate("parent", params); err != nil {
+		t.Fatal(err)
+	}
+
+	if !fs.IsStaged("heads/hubbub/policy") || fs.IsStaged("heads/master") {
+		t.Error("expected change to be staged on the pull request's branch")
+	}
+
+	params.Name = hubbub.String("OTHER.md")
+	params.PullRequest = &pullRequestParams{Title: "Something else"}
+	if _, err := fs.CreateOrUpdate("", params); err == nil {
+		t.Error("expected conflicting pull requests to fail")
+	}
+}
+
+func TestFileParamsRenderTemplate(t *testing.T) {
+	facts := hubbub.NewFacts(map[string]interface{}{
+		"repo.owner": "rjz",
+		"repo.name":  "hubbub",
+		"repo.team":  "platform",
+	})
+
+	raw := json.RawMessage(`{"state": "present", "ref": "heads/master", "name": ".github/CODEOWNERS", "filename": "__fixtures/CODEOWNERS.tmpl", "template": true}`)
+	params, err := parseFileParams(&raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := params.render(facts); err != nil {
+		t.Fatal(err)
+	}
+
+	if *params.Content != "* @rjz/platform\n" {
+		t.Error("expected rendered content, got", *params.Content)
+	}
+}
+
+func TestFileServiceComparesRenderedContent(t *testing.T) {
+	fs := NewFileService(nil, "rjz", "uno", true, false)
+	fs.RefTrees["parent"] = treeFixture
+
+	params := fileParams{
+		Name:     hubbub.String("README.md"),
+		Content:  hubbub.String(`{{ if eq .repo.name "hubbub" }}hello{{ end }}`),
+		Ref:      hubbub.String("heads/master"),
+		Template: true,
+	}
+	if err := params.render(hubbub.NewFacts(map[string]interface{}{"repo.name": "hubbub"})); err != nil {
+		t.Fatal(err)
+	}
+
+	change, err := fs.CreateOrUpdate("parent", params)
+	if err != nil || change.Action != hubbub.Unchanged {
+		t.Error("expected unchanged output to leave README.md unchanged, got", change, err)
+	}
+}
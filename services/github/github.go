@@ -7,17 +7,34 @@ import (
 	hubbub "github.com/rjz/hubbub/common"
 	"golang.org/x/oauth2"
 	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
 )
 
 type sha string
 
 // Serves policy goals related to github
 type GithubService struct {
-	Client      *github.Client
-	HookService *HookService
-	FileService *FileService
-	RepoOwner   string
-	RepoName    string
+	Client                  *github.Client
+	HookService             *HookService
+	FileService             *FileService
+	BranchProtectionService *BranchProtectionService
+	SettingsService         *RepositorySettingsService
+	LabelService            *LabelService
+	TeamAccessService       *TeamAccessService
+	CollaboratorService     *CollaboratorService
+	DeployKeyService        *DeployKeyService
+	RepoOwner               string
+	RepoName                string
+	DryRun                  bool
+
+	// Facts are available to templated files
+	Facts *hubbub.Facts
+
+	// BatchCommits stages file changes to each ref so that they can be
+	// committed together when the service is flushed
+	BatchCommits bool
 }
 
 // fileParams describe a "github_file" goal
@@ -27,6 +44,44 @@ type fileParams struct {
 	Filename *string `json:"filename,omitempty"`
 	Name     *string `json:"name,omitempty"`
 	Ref      *string `json:"ref,omitempty"`
+
+	// Template renders the content as a Go template with the session's facts
+	Template bool `json:"template,omitempty"`
+
+	// PullRequest delivers changes to the file by pull request, rather than
+	// committing them to ref directly
+	PullRequest *pullRequestParams `json:"pull_request,omitempty"`
+}
+
+// render replaces templated content with its output
+func (params *fileParams) render(f *hubbub.Facts) error {
+	if !params.Template || params.Content == nil {
+		return nil
+	}
+
+	rendered, err := hubbub.RenderTemplate(*params.Name, *params.Content, f)
+	if err != nil {
+		return err
+	}
+	params.Content = &rendered
+	return nil
+}
+
+// pullRequest describes the pull request that delivers changes to the file,
+// if there is one
+func (params *fileParams) pullRequest() *pullRequest {
+	if params.PullRequest == nil {
+		return nil
+	}
+	return newPullRequest(*params.Ref, params.PullRequest)
+}
+
+// target is the ref that changes to the file are committed to
+func (params *fileParams) target() string {
+	if pr := params.pullRequest(); pr != nil {
+		return pr.ref()
+	}
+	return *params.Ref
 }
 
 func (params *fileParams) loadContent() error {
@@ -44,18 +99,50 @@ func (params *fileParams) loadContent() error {
 	return nil
 }
 
+// normalize loads content from a file and cleans the file's name
+func (params *fileParams) normalize() error {
+	if params.Filename != nil {
+		if err := params.loadContent(); err != nil {
+			return err
+		}
+	}
+
+	if params.Name != nil {
+		// files are found by their full path within the repository
+		name := strings.TrimPrefix(path.Clean(*params.Name), "/")
+		params.Name = &name
+	}
+	return nil
+}
+
 func parseFileParams(attrs *json.RawMessage) (*fileParams, error) {
 	params := fileParams{}
 	if err := json.Unmarshal([]byte(*attrs), &params); err != nil {
 		return nil, err
 	}
 
-	if params.Filename != nil {
-		if err := params.loadContent(); err != nil {
-			return nil, err
-		}
+	if err := params.normalize(); err != nil {
+		return nil, err
+	}
+	return &params, nil
+}
+
+func parseFileBlockParams(attrs *json.RawMessage) (*fileBlockParams, error) {
+	params := fileBlockParams{
+		BeginMarker: defaultBeginMarker,
+		EndMarker:   defaultEndMarker,
+	}
+	if err := json.Unmarshal([]byte(*attrs), &params); err != nil {
+		return nil, err
+	}
+
+	if params.BeginMarker == params.EndMarker {
+		return nil, errors.New("Ambiguous argument: begin_marker and end_marker must differ")
 	}
 
+	if err := params.normalize(); err != nil {
+		return nil, err
+	}
 	return &params, nil
 }
 
@@ -80,56 +167,338 @@ func parseHookParams(attrs *json.RawMessage) (*hookParams, error) {
 	return &params, nil
 }
 
-func (s *GithubService) doWebhook(msg *json.RawMessage) error {
+// branchProtectionParams describe a "github_branch_protection" goal
+type branchProtectionParams struct {
+	State  string `json:"state,omitempty"`
+	Branch string `json:"branch,omitempty"`
+	BranchProtection
+}
+
+func parseBranchProtectionParams(attrs *json.RawMessage) (*branchProtectionParams, error) {
+	params := branchProtectionParams{}
+	if err := json.Unmarshal([]byte(*attrs), &params); err != nil {
+		return nil, err
+	}
+	return &params, nil
+}
+
+// parseRepositorySettingsParams parses a "github_repository_settings" goal
+func parseRepositorySettingsParams(attrs *json.RawMessage) (*RepositorySettings, error) {
+	params := RepositorySettings{}
+	if err := json.Unmarshal([]byte(*attrs), &params); err != nil {
+		return nil, err
+	}
+	return &params, nil
+}
+
+// labelsParams describe a "github_labels" goal
+type labelsParams struct {
+	Labels []labelParams `json:"labels"`
+	Prune  bool          `json:"prune,omitempty"`
+}
+
+func parseLabelsParams(attrs *json.RawMessage) (*labelsParams, error) {
+	params := labelsParams{}
+	if err := json.Unmarshal([]byte(*attrs), &params); err != nil {
+		return nil, err
+	}
+
+	for i := range params.Labels {
+		params.Labels[i].Color = normalizeColor(params.Labels[i].Color)
+	}
+	return &params, nil
+}
+
+// accessParams describe "github_team_access" and "github_collaborator" goals
+type accessParams struct {
+	Teams         []accessGrant `json:"teams,omitempty"`
+	Collaborators []accessGrant `json:"collaborators,omitempty"`
+	Exclusive     bool          `json:"exclusive,omitempty"`
+}
+
+func parseAccessParams(attrs *json.RawMessage) (*accessParams, error) {
+	params := accessParams{}
+	if err := json.Unmarshal([]byte(*attrs), &params); err != nil {
+		return nil, err
+	}
+	return &params, nil
+}
+
+// deployKeyParams describe a "github_deploy_key" goal
+type deployKeyParams struct {
+	State   string  `json:"state,omitempty"`
+	Keyfile *string `json:"keyfile,omitempty"`
+	deployKey
+}
+
+func (params *deployKeyParams) loadKey() error {
+	if params.Key != nil {
+		return errors.New("Ambiguous argument: cannot specify both key and keyfile")
+	}
+
+	data, err := ioutil.ReadFile(*params.Keyfile)
+	if err != nil {
+		return err
+	}
+
+	key := strings.TrimSpace(string(data))
+	params.Key = &key
+	return nil
+}
+
+func parseDeployKeyParams(attrs *json.RawMessage) (*deployKeyParams, error) {
+	params := deployKeyParams{}
+	if err := json.Unmarshal([]byte(*attrs), &params); err != nil {
+		return nil, err
+	}
+
+	if params.Keyfile != nil {
+		if err := params.loadKey(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &params, nil
+}
+
+// isNotFound reports whether github responded to a request with a 404
+func isNotFound(err error) bool {
+	errResp, ok := err.(*github.ErrorResponse)
+	return ok && errResp.Response != nil && errResp.Response.StatusCode == http.StatusNotFound
+}
+
+// asChanges wraps the outcome of a goal that manages a single resource
+func asChanges(c *hubbub.Change, err error) ([]hubbub.Change, error) {
+	if c == nil {
+		return nil, err
+	}
+	return []hubbub.Change{*c}, err
+}
+
+func (s *GithubService) doWebhook(msg *json.RawMessage) ([]hubbub.Change, error) {
 	if s.HookService == nil {
-		hs, err := NewHookService(s.Client, s.RepoOwner, s.RepoName)
+		hs, err := NewHookService(s.Client, s.RepoOwner, s.RepoName, s.DryRun)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		s.HookService = hs
 	}
 
 	params, err := parseHookParams(msg)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	switch params.State {
 	case "present":
-		return s.HookService.CreateOrUpdate(params.Hook)
+		return asChanges(s.HookService.CreateOrUpdate(params.Hook))
 	case "absent":
-		return s.HookService.Remove(params.Hook)
+		return asChanges(s.HookService.Remove(params.Hook))
 	default:
-		return errors.New("unknown state.")
+		return nil, errors.New("unknown state.")
 	}
 }
 
-func (s *GithubService) doFile(msg *json.RawMessage) error {
+// prepareFile fetches the tree that changes to the file described by params
+// will build on, returning its SHA and (if the changes are delivered by pull
+// request) the change to the pull request
+func (s *GithubService) prepareFile(params *fileParams) (sha, *hubbub.Change, error) {
+	if err := params.render(s.Facts); err != nil {
+		return "", nil, err
+	}
+
+	if s.FileService == nil {
+		s.FileService = NewFileService(s.Client, s.RepoOwner, s.RepoName, s.DryRun, s.BatchCommits)
+	}
+
+	// find current SHA for ref, unless changes to it are already staged
+	var SHA sha
+	staged := s.FileService.IsStaged(params.target())
+	if !staged {
+		refSHA, err := s.refSHA(*params.Ref)
+		if err != nil {
+			return "", nil, err
+		}
+		SHA = *refSHA
+	}
+
+	var prChange *hubbub.Change
+	if pr := params.pullRequest(); pr != nil {
+		existing, err := s.FileService.PullRequests.Find(pr)
+		if err != nil {
+			return "", nil, err
+		}
+
+		// changes to an open pull request build on its branch
+		if existing != nil && !staged {
+			refSHA, err := s.refSHA(pr.ref())
+			if err != nil {
+				return "", nil, err
+			}
+			SHA = *refSHA
+		}
+		change := pullRequestChange(pr, existing)
+		prChange = &change
+	}
+
+	if !staged {
+		if err := s.FileService.TreeFacts(SHA); err != nil {
+			return "", nil, err
+		}
+	}
+	return SHA, prChange, nil
+}
+
+// withPullRequest adds the change to a pull request to the first changed file
+// it delivers. In a dry run, an open pull request is reported even if the file
+// matches its branch, since its changes haven't reached the base branch yet.
+func (s *GithubService) withPullRequest(change *hubbub.Change, err error, prChange *hubbub.Change) ([]hubbub.Change, error) {
+	changes, err := asChanges(change, err)
+	if prChange == nil || change == nil {
+		return changes, err
+	}
+
+	pending := s.DryRun && prChange.Action == hubbub.Update
+	if change.IsChanged() || pending {
+		changes = append(changes, s.FileService.PullRequests.reportOnce(*prChange)...)
+	}
+	return changes, err
+}
+
+func (s *GithubService) doFile(msg *json.RawMessage) ([]hubbub.Change, error) {
 	params, err := parseFileParams(msg)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// find current SHA for ref
-	SHA, err := s.refSHA(*params.Ref)
+	SHA, prChange, err := s.prepareFile(params)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if s.FileService == nil {
-		s.FileService = NewFileService(s.Client, s.RepoOwner, s.RepoName)
+	var change *hubbub.Change
+	switch *params.State {
+	case "present":
+		change, err = s.FileService.CreateOrUpdate(SHA, *params)
+	case "absent":
+		change, err = s.FileService.Remove(SHA, *params)
+	default:
+		return nil, errors.New("unknown state.")
 	}
 
-	if err := s.FileService.TreeFacts(*SHA); err != nil {
-		return err
+	return s.withPullRequest(change, err, prChange)
+}
+
+func (s *GithubService) doFileBlock(msg *json.RawMessage) ([]hubbub.Change, error) {
+	params, err := parseFileBlockParams(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	SHA, prChange, err := s.prepareFile(&params.fileParams)
+	if err != nil {
+		return nil, err
 	}
 
 	switch *params.State {
+	case "present", "absent":
+		change, err := s.FileService.ApplyBlock(SHA, *params)
+		return s.withPullRequest(change, err, prChange)
+	default:
+		return nil, errors.New("unknown state.")
+	}
+}
+
+func (s *GithubService) doBranchProtection(msg *json.RawMessage) ([]hubbub.Change, error) {
+	if s.BranchProtectionService == nil {
+		s.BranchProtectionService = NewBranchProtectionService(s.Client, s.RepoOwner, s.RepoName, s.DryRun)
+	}
+
+	params, err := parseBranchProtectionParams(msg)
+	if err != nil {
+		return nil, err
+	}
+	switch params.State {
 	case "present":
-		return s.FileService.CreateOrUpdate(*SHA, *params)
+		return asChanges(s.BranchProtectionService.CreateOrUpdate(params.Branch, &params.BranchProtection))
 	case "absent":
-		return s.FileService.Remove(*SHA, *params)
+		return asChanges(s.BranchProtectionService.Remove(params.Branch))
 	default:
-		return errors.New("unknown state.")
+		return nil, errors.New("unknown state.")
+	}
+}
+
+func (s *GithubService) doRepositorySettings(msg *json.RawMessage) ([]hubbub.Change, error) {
+	if s.SettingsService == nil {
+		s.SettingsService = NewRepositorySettingsService(s.Client, s.RepoOwner, s.RepoName, s.DryRun)
+	}
+
+	settings, err := parseRepositorySettingsParams(msg)
+	if err != nil {
+		return nil, err
+	}
+	return asChanges(s.SettingsService.Update(settings))
+}
+
+func (s *GithubService) doLabels(msg *json.RawMessage) ([]hubbub.Change, error) {
+	if s.LabelService == nil {
+		ls, err := NewLabelService(s.Client, s.RepoOwner, s.RepoName, s.DryRun)
+		if err != nil {
+			return nil, err
+		}
+		s.LabelService = ls
+	}
+
+	params, err := parseLabelsParams(msg)
+	if err != nil {
+		return nil, err
+	}
+	return s.LabelService.Apply(params.Labels, params.Prune)
+}
+
+func (s *GithubService) doTeamAccess(msg *json.RawMessage) ([]hubbub.Change, error) {
+	if s.TeamAccessService == nil {
+		s.TeamAccessService = NewTeamAccessService(s.Client, s.RepoOwner, s.RepoName, s.DryRun)
+	}
+
+	params, err := parseAccessParams(msg)
+	if err != nil {
+		return nil, err
+	}
+	return s.TeamAccessService.Apply(params.Teams, params.Exclusive)
+}
+
+func (s *GithubService) doCollaborator(msg *json.RawMessage) ([]hubbub.Change, error) {
+	if s.CollaboratorService == nil {
+		s.CollaboratorService = NewCollaboratorService(s.Client, s.RepoOwner, s.RepoName, s.DryRun)
+	}
+
+	params, err := parseAccessParams(msg)
+	if err != nil {
+		return nil, err
+	}
+	return s.CollaboratorService.Apply(params.Collaborators, params.Exclusive)
+}
+
+func (s *GithubService) doDeployKey(msg *json.RawMessage) ([]hubbub.Change, error) {
+	if s.DeployKeyService == nil {
+		dks, err := NewDeployKeyService(s.Client, s.RepoOwner, s.RepoName, s.DryRun)
+		if err != nil {
+			return nil, err
+		}
+		s.DeployKeyService = dks
+	}
+
+	params, err := parseDeployKeyParams(msg)
+	if err != nil {
+		return nil, err
+	}
+	switch params.State {
+	case "present":
+		return asChanges(s.DeployKeyService.CreateOrUpdate(&params.deployKey))
+	case "absent":
+		return asChanges(s.DeployKeyService.Remove(&params.deployKey))
+	default:
+		return nil, errors.New("unknown state.")
 	}
 }
 
@@ -143,32 +512,76 @@ func (s *GithubService) refSHA(refName string) (*sha, error) {
 	return &refSHA, nil
 }
 
-func (s *GithubService) Do(goal string, msg *json.RawMessage) error {
+func (s *GithubService) Do(goal string, msg *json.RawMessage) ([]hubbub.Change, error) {
 	switch goal {
 	case "github_webhook":
 		return s.doWebhook(msg)
 	case "github_file":
 		return s.doFile(msg)
+	case "github_file_block":
+		return s.doFileBlock(msg)
+	case "github_branch_protection":
+		return s.doBranchProtection(msg)
+	case "github_repository_settings":
+		return s.doRepositorySettings(msg)
+	case "github_labels":
+		return s.doLabels(msg)
+	case "github_team_access":
+		return s.doTeamAccess(msg)
+	case "github_collaborator":
+		return s.doCollaborator(msg)
+	case "github_deploy_key":
+		return s.doDeployKey(msg)
 	}
-	return nil
+	return nil, nil
 }
 
-func GithubServiceFactory(facts *hubbub.Facts) (*hubbub.Service, error) {
+// Flush commits any file changes staged in batch mode
+func (s *GithubService) Flush() error {
+	if s.FileService == nil {
+		return nil
+	}
+	return s.FileService.Flush()
+}
+
+// newClient configures a github client using the access token (and retry
+// policy) in facts
+func newClient(facts *hubbub.Facts) (*github.Client, error) {
 	if !facts.IsAvailable("github.access_token") {
 		return nil, errors.New("no github access token available")
 	}
 
 	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: facts.GetString("github.access_token")})
 	oc := oauth2.NewClient(oauth2.NoContext, ts)
-	gs := GithubService{github.NewClient(oc), nil, nil, facts.GetString("repo.owner"), facts.GetString("repo.name")}
+	oc.Transport = &retryingTransport{
+		base:   &rateLimitedTransport{oc.Transport, sharedRateLimiter},
+		policy: hubbub.NewRetryPolicy(facts),
+	}
+	return github.NewClient(oc), nil
+}
+
+func GithubServiceFactory(facts *hubbub.Facts) (*hubbub.Service, error) {
+	client, err := newClient(facts)
+	if err != nil {
+		return nil, err
+	}
+
+	gs := GithubService{
+		Client:    client,
+		RepoOwner: facts.GetString("repo.owner"),
+		RepoName:  facts.GetString("repo.name"),
+		DryRun:    facts.IsDryRun(),
+		Facts:     facts,
+	}
+
+	if facts.IsAvailable("github.batch_commits") {
+		gs.BatchCommits = facts.GetBool("github.batch_commits")
+	}
 
 	svc := hubbub.Service(&gs)
 	return &svc, nil
 }
 
 func init() {
-	hubbub.RegisterService([]string{
-		"github_webhook",
-		"github_file",
-	}, GithubServiceFactory)
+	hubbub.RegisterService(goals, GithubServiceFactory)
 }
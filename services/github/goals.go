@@ -0,0 +1,404 @@
+package github_service
+
+import (
+	hubbub "github.com/rjz/hubbub/common"
+)
+
+// stateSchema describes the `state` shared by most goals
+var stateSchema = &hubbub.Schema{
+	Type:        "string",
+	Description: "one of `\"absent\"` OR `\"present\"`",
+	Enum:        []interface{}{"present", "absent"},
+}
+
+// fileSchema describes a "github_file" goal
+var fileSchema = &hubbub.Schema{
+	Type:     "object",
+	Required: []string{"state", "ref", "name"},
+	Properties: map[string]*hubbub.Schema{
+		"state":    stateSchema,
+		"ref":      {Type: "string", Description: "a valid ref (e.g. `\"heads/master\"` for the master branch)"},
+		"name":     {Type: "string", Description: "the file's path within the repo (e.g. `\".github/workflows/ci.yml\"`)"},
+		"content":  {Type: "string", Description: "the content"},
+		"filename": {Type: "string", Description: "the local file to copy to the repo"},
+		"template": {Type: "boolean", Description: "render the content as a Go template with the repository's facts"},
+		"pull_request": {
+			Type:        "object",
+			Description: "deliver changes by pull request into `ref`, rather than committing them to it directly",
+			Properties: map[string]*hubbub.Schema{
+				"branch":    {Type: "string", Description: "the branch to push changes to (default `\"hubbub/policy\"`)"},
+				"title":     {Type: "string", Description: "the pull request's title"},
+				"body":      {Type: "string", Description: "the pull request's description"},
+				"labels":    {Type: "array", Description: "labels to add to the pull request", Items: &hubbub.Schema{Type: "string"}},
+				"reviewers": {Type: "array", Description: "users to request reviews from", Items: &hubbub.Schema{Type: "string"}},
+			},
+			AdditionalProperties: hubbub.Bool(false),
+		},
+	},
+	AdditionalProperties: hubbub.Bool(false),
+	OneOf: []*hubbub.Schema{
+		{
+			Description: "an absent file",
+			Properties:  map[string]*hubbub.Schema{"state": {Enum: []interface{}{"absent"}}},
+		},
+		{
+			Description: "a file with content",
+			Properties:  map[string]*hubbub.Schema{"state": {Enum: []interface{}{"present"}}},
+			Required:    []string{"content"},
+		},
+		{
+			Description: "a file copied from filename",
+			Properties:  map[string]*hubbub.Schema{"state": {Enum: []interface{}{"present"}}},
+			Required:    []string{"filename"},
+		},
+	},
+}
+
+// fileBlockSchema describes a "github_file_block" goal, which takes the
+// parameters of a "github_file" goal as well as the markers around the block
+var fileBlockSchema = func() *hubbub.Schema {
+	properties := map[string]*hubbub.Schema{
+		"begin_marker": {Type: "string", Description: "the line preceding the block (default `\"# BEGIN hubbub\"`)"},
+		"end_marker":   {Type: "string", Description: "the line following the block (default `\"# END hubbub\"`)"},
+	}
+	for k, v := range fileSchema.Properties {
+		properties[k] = v
+	}
+	properties["content"] = &hubbub.Schema{Type: "string", Description: "the content of the block"}
+	properties["filename"] = &hubbub.Schema{Type: "string", Description: "the local file to copy into the block"}
+
+	return &hubbub.Schema{
+		Type:                 "object",
+		Required:             fileSchema.Required,
+		Properties:           properties,
+		AdditionalProperties: hubbub.Bool(false),
+		OneOf: []*hubbub.Schema{
+			{
+				Description: "an absent block",
+				Properties:  map[string]*hubbub.Schema{"state": {Enum: []interface{}{"absent"}}},
+			},
+			{
+				Description: "a block with content",
+				Properties:  map[string]*hubbub.Schema{"state": {Enum: []interface{}{"present"}}},
+				Required:    []string{"content"},
+			},
+			{
+				Description: "a block copied from filename",
+				Properties:  map[string]*hubbub.Schema{"state": {Enum: []interface{}{"present"}}},
+				Required:    []string{"filename"},
+			},
+		},
+	}
+}()
+
+// webhookSchema describes a "github_webhook" goal
+var webhookSchema = &hubbub.Schema{
+	Type:     "object",
+	Required: []string{"state", "config"},
+	Properties: map[string]*hubbub.Schema{
+		"state":  stateSchema,
+		"active": {Type: "boolean", Description: "whether the hook should be enabled"},
+		"events": {
+			Type:        "array",
+			Description: "events to apply the hook to (see https://developer.github.com/webhooks/#events)",
+			Items:       &hubbub.Schema{Type: "string"},
+		},
+		"name": {Type: "string", Description: "default `\"web\"`; override for service hooks"},
+		"config": {
+			Type:        "object",
+			Description: "settings for the hook; format varies by service, but hooks are identified by `url`",
+			Required:    []string{"url"},
+			Properties: map[string]*hubbub.Schema{
+				"url": {Type: "string", Description: "the URL payloads are delivered to"},
+			},
+		},
+	},
+}
+
+// branchProtectionSchema describes a "github_branch_protection" goal
+var branchProtectionSchema = &hubbub.Schema{
+	Type:     "object",
+	Required: []string{"state", "branch"},
+	Properties: map[string]*hubbub.Schema{
+		"state":  stateSchema,
+		"branch": {Type: "string", Description: "the branch to protect (e.g. `\"master\"`)"},
+		"required_status_checks": {
+			Type:        "object",
+			Description: "status checks that must pass before merging",
+			Properties: map[string]*hubbub.Schema{
+				"strict":   {Type: "boolean", Description: "require branches to be up to date before merging"},
+				"contexts": {Type: "array", Description: "names of the required checks", Items: &hubbub.Schema{Type: "string"}},
+			},
+			AdditionalProperties: hubbub.Bool(false),
+		},
+		"required_pull_request_reviews": {
+			Type:        "object",
+			Description: "reviews required before merging",
+			Properties: map[string]*hubbub.Schema{
+				"dismiss_stale_reviews":           {Type: "boolean", Description: "dismiss approvals when new commits are pushed"},
+				"require_code_owner_reviews":      {Type: "boolean", Description: "require review from code owners"},
+				"required_approving_review_count": {Type: "integer", Description: "default: 1"},
+			},
+			AdditionalProperties: hubbub.Bool(false),
+		},
+		"enforce_admins": {Type: "boolean", Description: "apply the protection to administrators, too"},
+		"restrictions": {
+			Type:        "object",
+			Description: "the only users and teams (by slug) allowed to push",
+			Properties: map[string]*hubbub.Schema{
+				"users": {Type: "array", Items: &hubbub.Schema{Type: "string"}},
+				"teams": {Type: "array", Items: &hubbub.Schema{Type: "string"}},
+			},
+			AdditionalProperties: hubbub.Bool(false),
+		},
+	},
+	AdditionalProperties: hubbub.Bool(false),
+}
+
+// repositorySettingsSchema describes a "github_repository_settings" goal
+var repositorySettingsSchema = &hubbub.Schema{
+	Type: "object",
+	Properties: map[string]*hubbub.Schema{
+		"description": {Type: "string", Description: "a short description of the repository"},
+		"homepage":    {Type: "string", Description: "the repository's website"},
+		"visibility": {
+			Type:        "string",
+			Description: "one of `\"public\"`, `\"private\"` OR `\"internal\"`",
+			Enum:        []interface{}{"public", "private", "internal"},
+		},
+		"default_branch":         {Type: "string", Description: "the branch pull requests are opened against by default"},
+		"has_issues":             {Type: "boolean", Description: "enable issues"},
+		"has_wiki":               {Type: "boolean", Description: "enable the wiki"},
+		"has_projects":           {Type: "boolean", Description: "enable projects"},
+		"allow_merge_commit":     {Type: "boolean", Description: "allow pull requests to be merged with a merge commit"},
+		"allow_squash_merge":     {Type: "boolean", Description: "allow pull requests to be squashed and merged"},
+		"allow_rebase_merge":     {Type: "boolean", Description: "allow pull requests to be rebased and merged"},
+		"delete_branch_on_merge": {Type: "boolean", Description: "delete head branches once their pull requests are merged"},
+	},
+	AdditionalProperties: hubbub.Bool(false),
+}
+
+// labelsSchema describes a "github_labels" goal
+var labelsSchema = &hubbub.Schema{
+	Type:     "object",
+	Required: []string{"labels"},
+	Properties: map[string]*hubbub.Schema{
+		"labels": {
+			Type:        "array",
+			Description: "the labels the repository should have, each with a `name`, `color`, and (optional) `description` and `aliases`",
+			Items: &hubbub.Schema{
+				Type:     "object",
+				Required: []string{"name", "color"},
+				Properties: map[string]*hubbub.Schema{
+					"name":        {Type: "string"},
+					"color":       {Type: "string"},
+					"description": {Type: "string"},
+					"aliases":     {Type: "array", Items: &hubbub.Schema{Type: "string"}},
+				},
+				AdditionalProperties: hubbub.Bool(false),
+			},
+		},
+		"prune": {Type: "boolean", Description: "delete labels that aren't listed"},
+	},
+	AdditionalProperties: hubbub.Bool(false),
+}
+
+// permissionSchema describes the level of access granted to a repository
+var permissionSchema = &hubbub.Schema{
+	Type:        "string",
+	Description: "one of `\"pull\"`, `\"triage\"`, `\"push\"`, `\"maintain\"` OR `\"admin\"`",
+	Enum:        []interface{}{"pull", "triage", "push", "maintain", "admin"},
+}
+
+// accessSchema describes the grants in a "github_team_access" or
+// "github_collaborator" goal, identified by key
+func accessSchema(key, grantee, description string) *hubbub.Schema {
+	return &hubbub.Schema{
+		Type:     "object",
+		Required: []string{key},
+		Properties: map[string]*hubbub.Schema{
+			key: {
+				Type:        "array",
+				Description: description,
+				Items: &hubbub.Schema{
+					Type:     "object",
+					Required: []string{grantee},
+					Properties: map[string]*hubbub.Schema{
+						grantee:      {Type: "string"},
+						"permission": permissionSchema,
+						"state":      stateSchema,
+					},
+					AdditionalProperties: hubbub.Bool(false),
+					OneOf: []*hubbub.Schema{
+						{
+							Description: "revoked access",
+							Required:    []string{"state"},
+							Properties:  map[string]*hubbub.Schema{"state": {Enum: []interface{}{"absent"}}},
+						},
+						{
+							Description: "granted access",
+							Required:    []string{"permission"},
+							Properties:  map[string]*hubbub.Schema{"state": {Enum: []interface{}{"present"}}},
+						},
+					},
+				},
+			},
+			"exclusive": {Type: "boolean", Description: "revoke access from anyone who isn't listed"},
+		},
+		AdditionalProperties: hubbub.Bool(false),
+	}
+}
+
+// deployKeySchema describes a "github_deploy_key" goal
+var deployKeySchema = &hubbub.Schema{
+	Type:     "object",
+	Required: []string{"state", "title"},
+	Properties: map[string]*hubbub.Schema{
+		"state":     stateSchema,
+		"title":     {Type: "string", Description: "the name of the key"},
+		"key":       {Type: "string", Description: "the public key, e.g. `\"ssh-ed25519 AAAA...\"`"},
+		"keyfile":   {Type: "string", Description: "the local file containing the public key"},
+		"read_only": {Type: "boolean", Description: "default: false; prevent the key from being used to push"},
+	},
+	AdditionalProperties: hubbub.Bool(false),
+	OneOf: []*hubbub.Schema{
+		{
+			Description: "an absent key",
+			Properties:  map[string]*hubbub.Schema{"state": {Enum: []interface{}{"absent"}}},
+		},
+		{
+			Description: "a key",
+			Properties:  map[string]*hubbub.Schema{"state": {Enum: []interface{}{"present"}}},
+			Required:    []string{"key"},
+		},
+		{
+			Description: "a key read from keyfile",
+			Properties:  map[string]*hubbub.Schema{"state": {Enum: []interface{}{"present"}}},
+			Required:    []string{"keyfile"},
+		},
+	},
+}
+
+// goals lists the goals served by GithubService
+var goals = []hubbub.GoalDefinition{
+	{
+		Name:        "github_webhook",
+		Description: "Manage a github webhook. Hooks are identified by `config.url`.",
+		Schema:      webhookSchema,
+		Example: `{
+  "state": "present",
+  "config": {
+    "url": "https://my-service.com/hooks/github",
+    "content_type": "json",
+    "insecure_ssl": 0,
+    "secret": "abc123"
+  },
+  "active": true,
+  "events": [
+    "pull_request"
+  ]
+}`,
+	},
+	{
+		Name:        "github_file",
+		Description: "Manage a file within an existing git ref. Specify either `content` or `filename` for files that should be present.",
+		Schema:      fileSchema,
+		Example: `{
+  "state": "present",
+  "ref": "heads/master",
+  "name": ".gitignore",
+  "content": "npm-debug.log\nhumans.txt"
+}`,
+	},
+	{
+		Name:        "github_file_block",
+		Description: "Manage a block of lines within a file, between `begin_marker` and `end_marker`. A missing block is appended, and the rest of the file is left untouched.",
+		Schema:      fileBlockSchema,
+		Example: `{
+  "state": "present",
+  "ref": "heads/master",
+  "name": ".gitignore",
+  "content": "npm-debug.log\nhumans.txt"
+}`,
+	},
+	{
+		Name:        "github_branch_protection",
+		Description: "Protect a branch. Requirements that aren't specified are disabled.",
+		Schema:      branchProtectionSchema,
+		Example: `{
+  "state": "present",
+  "branch": "master",
+  "required_status_checks": {
+    "strict": true,
+    "contexts": ["continuous-integration/travis-ci"]
+  },
+  "required_pull_request_reviews": {
+    "dismiss_stale_reviews": true,
+    "required_approving_review_count": 2
+  },
+  "enforce_admins": true,
+  "restrictions": {
+    "users": [],
+    "teams": ["maintainers"]
+  }
+}`,
+	},
+	{
+		Name:        "github_repository_settings",
+		Description: "Update github repository settings. Settings that aren't specified are left alone.",
+		Schema:      repositorySettingsSchema,
+		Example: `{
+  "description": "Tools for managing repositories",
+  "has_wiki": false,
+  "allow_merge_commit": false,
+  "allow_squash_merge": true,
+  "delete_branch_on_merge": true
+}`,
+	},
+	{
+		Name:        "github_labels",
+		Description: "Manage the full set of issue labels in a repository.",
+		Schema:      labelsSchema,
+		Example: `{
+  "labels": [
+    { "name": "bug", "color": "d73a4a", "description": "Something isn't working" },
+    { "name": "enhancement", "color": "a2eeef", "aliases": ["feature"] }
+  ],
+  "prune": true
+}`,
+	},
+	{
+		Name:        "github_team_access",
+		Description: "Grant, change or revoke the access teams (in the repository's organization) have to it.",
+		Schema:      accessSchema("teams", "team", "teams (by slug) with their `permission`, or `state: \"absent\"` to revoke access"),
+		Example: `{
+  "teams": [
+    { "team": "core", "permission": "admin" },
+    { "team": "contractors", "state": "absent" }
+  ],
+  "exclusive": true
+}`,
+	},
+	{
+		Name:        "github_collaborator",
+		Description: "Grant, change or revoke users' direct access to a repository. New collaborators are invited.",
+		Schema:      accessSchema("collaborators", "user", "users (by login) with their `permission`, or `state: \"absent\"` to revoke access"),
+		Example: `{
+  "collaborators": [
+    { "user": "rjz", "permission": "maintain" }
+  ],
+  "exclusive": true
+}`,
+	},
+	{
+		Name:        "github_deploy_key",
+		Description: "Manage a deploy key, identified by its title or fingerprint. Keys that differ are replaced.",
+		Schema:      deployKeySchema,
+		Example: `{
+  "state": "present",
+  "title": "ci",
+  "keyfile": "./keys/ci.pub",
+  "read_only": true
+}`,
+	},
+}
@@ -0,0 +1,80 @@
+package github_service
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFileSchema(t *testing.T) {
+	valid := []string{
+		`{"state":"present","ref":"heads/master","name":"README.md","content":"hello"}`,
+		`{"state":"present","ref":"heads/master","name":"README.md","filename":"./README.md"}`,
+		`{"state":"absent","ref":"heads/master","name":"README.md"}`,
+	}
+	for _, raw := range valid {
+		if err := fileSchema.Validate(json.RawMessage(raw)); err != nil {
+			t.Error("expected", raw, "to be valid, got", err)
+		}
+	}
+
+	invalid := []string{
+		`{"state":"presnet","ref":"heads/master","name":"README.md","content":"hello"}`,
+		`{"state":"present","ref":"heads/master","name":"README.md"}`,
+		`{"state":"present","ref":"heads/master","name":"README.md","content":"hello","filename":"./README.md"}`,
+		`{"state":"present","name":"README.md","content":"hello"}`,
+	}
+	for _, raw := range invalid {
+		if err := fileSchema.Validate(json.RawMessage(raw)); err == nil {
+			t.Error("expected", raw, "to be invalid")
+		}
+	}
+}
+
+func TestGoalExamplesAreValid(t *testing.T) {
+	for _, d := range goals {
+		if err := d.Validate(json.RawMessage(d.Example)); err != nil {
+			t.Error("expected", d.Name, "example to be valid, got", err)
+		}
+	}
+}
+
+func TestFileBlockSchema(t *testing.T) {
+	valid := []string{
+		`{"state":"present","ref":"heads/master","name":".gitignore","content":"*.log"}`,
+		`{"state":"present","ref":"heads/master","name":"Makefile","filename":"./lint.mk","begin_marker":"# BEGIN lint","end_marker":"# END lint"}`,
+		`{"state":"absent","ref":"heads/master","name":".gitignore"}`,
+	}
+	for _, raw := range valid {
+		if err := fileBlockSchema.Validate(json.RawMessage(raw)); err != nil {
+			t.Error("expected", raw, "to be valid, got", err)
+		}
+	}
+
+	invalid := []string{
+		`{"state":"present","ref":"heads/master","name":".gitignore"}`,
+		`{"state":"present","ref":"heads/master","name":".gitignore","content":"*.log","begin_marker":1}`,
+	}
+	for _, raw := range invalid {
+		if err := fileBlockSchema.Validate(json.RawMessage(raw)); err == nil {
+			t.Error("expected", raw, "to be invalid")
+		}
+	}
+}
+
+func TestWebhookSchema(t *testing.T) {
+	valid := `{"state":"present","events":["push"],"config":{"url":"https://ci.example.com","content_type":"json"}}`
+	if err := webhookSchema.Validate(json.RawMessage(valid)); err != nil {
+		t.Error("expected", valid, "to be valid, got", err)
+	}
+
+	invalid := []string{
+		`{"state":"present","events":["push"]}`,
+		`{"state":"present","events":["push"],"config":{"content_type":"json"}}`,
+		`{"state":"present","events":["push"],"config":{"url":42}}`,
+	}
+	for _, raw := range invalid {
+		if err := webhookSchema.Validate(json.RawMessage(raw)); err == nil {
+			t.Error("expected", raw, "to be invalid")
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package github_service
+
+import (
+	"fmt"
+	"github.com/google/go-github/github"
+	hubbub "github.com/rjz/hubbub/common"
+	"net/url"
+	"strings"
+)
+
+// labelsPreview enables label descriptions in github's API
+const labelsPreview = "application/vnd.github.symmetra-preview+json"
+
+// label is an issue label as github represents it
+type label struct {
+	Name        string  `json:"name"`
+	Color       string  `json:"color"`
+	Description *string `json:"description,omitempty"`
+}
+
+// labelParams describe a label in a "github_labels" goal
+type labelParams struct {
+	label
+
+	// Aliases are former names of the label. An existing label with one of
+	// these names is renamed rather than replaced.
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+// labelMatches compares an existing label with the desired one. Colors are
+// compared without regard for case or a leading '#', and descriptions are only
+// compared if one is specified.
+func labelMatches(existing *label, desired *labelParams) bool {
+	if existing.Name != desired.Name || normalizeColor(existing.Color) != normalizeColor(desired.Color) {
+		return false
+	}
+
+	if desired.Description == nil {
+		return true
+	}
+	return existing.Description != nil && *existing.Description == *desired.Description
+}
+
+// normalizeColor formats a color the way github stores it
+func normalizeColor(color string) string {
+	return strings.ToLower(strings.TrimPrefix(color, "#"))
+}
+
+type LabelService struct {
+	Client    *github.Client
+	RepoOwner string
+	RepoName  string
+	Labels    []label
+	DryRun    bool
+}
+
+func NewLabelService(client *github.Client, owner, name string, dryRun bool) (*LabelService, error) {
+	ls := LabelService{client, owner, name, nil, dryRun}
+
+	for page := 1; page != 0; {
+		req, err := client.NewRequest("GET", fmt.Sprintf("%s?per_page=100&page=%d", ls.path(""), page), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", labelsPreview)
+
+		var labels []label
+		resp, err := client.Do(req, &labels)
+		if err != nil {
+			return nil, err
+		}
+
+		ls.Labels = append(ls.Labels, labels...)
+		page = resp.NextPage
+	}
+
+	return &ls, nil
+}
+
+// path locates a label (or, if name is empty, all labels) in github's API
+func (ls *LabelService) path(name string) string {
+	path := fmt.Sprintf("repos/%s/%s/labels", ls.RepoOwner, ls.RepoName)
+	if name == "" {
+		return path
+	}
+	return fmt.Sprintf("%s/%s", path, url.PathEscape(name))
+}
+
+// byName finds the existing label with name (github compares label names
+// case-insensitively)
+func (ls *LabelService) byName(name string) *label {
+	for i, l := range ls.Labels {
+		if strings.EqualFold(l.Name, name) {
+			return &ls.Labels[i]
+		}
+	}
+	return nil
+}
+
+// find locates the existing label for a desired label, by name or alias
+func (ls *LabelService) find(desired *labelParams) *label {
+	if l := ls.byName(desired.Name); l != nil {
+		return l
+	}
+	for _, alias := range desired.Aliases {
+		if l := ls.byName(alias); l != nil {
+			return l
+		}
+	}
+	return nil
+}
+
+// request sends a request about labels to github
+func (ls *LabelService) request(method, path string, body interface{}) error {
+	req, err := ls.Client.NewRequest(method, path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", labelsPreview)
+
+	_, err = ls.Client.Do(req, nil)
+	return err
+}
+
+func (ls *LabelService) createOrUpdate(desired *labelParams) (*hubbub.Change, error) {
+	existing := ls.find(desired)
+	change := hubbub.Change{Resource: desired.Name, After: desired.label}
+	if existing == nil {
+		change.Action = hubbub.Create
+		if ls.DryRun {
+			return &change, nil
+		}
+
+		if err := ls.request("POST", ls.path(""), desired.label); err != nil {
+			return &change, err
+		}
+		ls.Labels = append(ls.Labels, desired.label)
+		return &change, nil
+	}
+
+	change.Before = *existing
+	if labelMatches(existing, desired) {
+		change.Action = hubbub.Unchanged
+		return &change, nil
+	}
+
+	change.Action = hubbub.Update
+	if existing.Name != desired.Name {
+		change.Resource = fmt.Sprintf("%s (was %s)", desired.Name, existing.Name)
+	}
+	if ls.DryRun {
+		return &change, nil
+	}
+
+	update := map[string]interface{}{"new_name": desired.Name, "color": desired.Color}
+	if desired.Description != nil {
+		update["description"] = *desired.Description
+	}
+	if err := ls.request("PATCH", ls.path(existing.Name), update); err != nil {
+		return &change, err
+	}
+
+	existing.Name = desired.Name
+	existing.Color = desired.Color
+	if desired.Description != nil {
+		existing.Description = desired.Description
+	}
+	return &change, nil
+}
+
+// Apply creates, updates or renames each desired label. If prune is set,
+// labels that weren't desired are removed.
+func (ls *LabelService) Apply(desired []labelParams, prune bool) ([]hubbub.Change, error) {
+	var changes []hubbub.Change
+	managed := map[string]bool{}
+	for i := range desired {
+		if existing := ls.find(&desired[i]); existing != nil {
+			managed[strings.ToLower(existing.Name)] = true
+		}
+
+		change, err := ls.createOrUpdate(&desired[i])
+		if change != nil {
+			changes = append(changes, *change)
+		}
+		if err != nil {
+			return changes, err
+		}
+		managed[strings.ToLower(desired[i].Name)] = true
+	}
+
+	if !prune {
+		return changes, nil
+	}
+
+	var kept []label
+	for _, l := range ls.Labels {
+		if managed[strings.ToLower(l.Name)] {
+			kept = append(kept, l)
+			continue
+		}
+
+		changes = append(changes, hubbub.Change{Resource: l.Name, Action: hubbub.Delete, Before: l})
+		if ls.DryRun {
+			continue
+		}
+
+		if err := ls.request("DELETE", ls.path(l.Name), nil); err != nil {
+			return changes, err
+		}
+	}
+
+	if !ls.DryRun {
+		ls.Labels = kept
+	}
+	return changes, nil
+}
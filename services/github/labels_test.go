@@ -0,0 +1,67 @@
+package github_service
+
+import (
+	"encoding/json"
+	hubbub "github.com/rjz/hubbub/common"
+	"testing"
+)
+
+func labelServiceFixture() *LabelService {
+	return &LabelService{
+		RepoOwner: "rjz",
+		RepoName:  "uno",
+		DryRun:    true,
+		Labels: []label{
+			{Name: "bug", Color: "d73a4a"},
+			{Name: "Feature", Color: "a2eeef"},
+			{Name: "wontfix", Color: "ffffff"},
+		},
+	}
+}
+
+func TestLabelMatches(t *testing.T) {
+	existing := label{Name: "bug", Color: "d73a4a", Description: hubbub.String("broken")}
+
+	if !labelMatches(&existing, &labelParams{label: label{Name: "bug", Color: "#D73A4A"}}) {
+		t.Error("expected color to match regardless of case and '#'")
+	}
+
+	if labelMatches(&existing, &labelParams{label: label{Name: "bug", Color: "d73a4a", Description: hubbub.String("")}}) {
+		t.Error("expected description to differ")
+	}
+}
+
+func TestLabelServiceApply(t *testing.T) {
+	raw := json.RawMessage(`{
+		"labels": [
+			{ "name": "bug", "color": "#D73A4A" },
+			{ "name": "enhancement", "color": "a2eeef", "aliases": ["feature"] },
+			{ "name": "help wanted", "color": "008672" }
+		],
+		"prune": true
+	}`)
+	params, err := parseLabelsParams(&raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := labelServiceFixture().Apply(params.Labels, params.Prune)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []hubbub.Action{hubbub.Unchanged, hubbub.Update, hubbub.Create, hubbub.Delete}
+	if len(changes) != len(expected) {
+		t.Fatal("expected", len(expected), "changes, got", changes)
+	}
+
+	for i, action := range expected {
+		if changes[i].Action != action {
+			t.Error("expected", action, "got", changes[i])
+		}
+	}
+
+	if changes[1].Resource != "enhancement (was Feature)" || changes[3].Resource != "wontfix" {
+		t.Error("unexpected changes", changes)
+	}
+}
@@ -0,0 +1,151 @@
+package github_service
+
+import (
+	"fmt"
+	"github.com/google/go-github/github"
+	hubbub "github.com/rjz/hubbub/common"
+	"reflect"
+	"strings"
+)
+
+const (
+	defaultPullRequestBranch = "hubbub/policy"
+	defaultPullRequestTitle  = "Apply hubbub policy"
+)
+
+// pullRequestParams describe how changes to a file are delivered for review
+type pullRequestParams struct {
+	Branch    string   `json:"branch,omitempty"`
+	Title     string   `json:"title,omitempty"`
+	Body      string   `json:"body,omitempty"`
+	Labels    []string `json:"labels,omitempty"`
+	Reviewers []string `json:"reviewers,omitempty"`
+}
+
+// withDefaults fills in the branch and title if they weren't specified
+func (params pullRequestParams) withDefaults() *pullRequestParams {
+	if params.Branch == "" {
+		params.Branch = defaultPullRequestBranch
+	}
+	if params.Title == "" {
+		params.Title = defaultPullRequestTitle
+	}
+	return &params
+}
+
+// pullRequest is a pull request proposing the changes staged on a branch
+type pullRequest struct {
+	*pullRequestParams
+
+	// Base is the branch the changes are proposed to (e.g. "master")
+	Base string
+}
+
+// newPullRequest describes a pull request from params' branch into baseRef
+func newPullRequest(baseRef string, params *pullRequestParams) *pullRequest {
+	return &pullRequest{params.withDefaults(), strings.TrimPrefix(baseRef, "heads/")}
+}
+
+// ref is the ref of the pull request's branch
+func (pr *pullRequest) ref() string {
+	return fmt.Sprintf("heads/%s", pr.Branch)
+}
+
+// matches reports whether two goals describe the same pull request
+func (pr *pullRequest) matches(other *pullRequest) bool {
+	return reflect.DeepEqual(pr, other)
+}
+
+// resource names the pull request in reported changes
+func (pr *pullRequest) resource() string {
+	return fmt.Sprintf("pull request from '%s' into '%s'", pr.Branch, pr.Base)
+}
+
+type PullRequestService struct {
+	Client    *github.Client
+	RepoOwner string
+	RepoName  string
+
+	// reported lists the pull requests whose changes have been reported, so
+	// that files delivered by the same pull request don't repeat it
+	reported map[string]bool
+}
+
+func NewPullRequestService(client *github.Client, owner, name string) *PullRequestService {
+	return &PullRequestService{client, owner, name, make(map[string]bool)}
+}
+
+// reportOnce returns the change to a pull request the first time it's
+// reported, and nothing afterwards
+func (prs *PullRequestService) reportOnce(change hubbub.Change) []hubbub.Change {
+	if prs.reported[change.Resource] {
+		return nil
+	}
+	prs.reported[change.Resource] = true
+	return []hubbub.Change{change}
+}
+
+// Find looks for the open pull request from pr's branch into its base
+func (prs *PullRequestService) Find(pr *pullRequest) (*github.PullRequest, error) {
+	opts := github.PullRequestListOptions{
+		State: "open",
+		Head:  fmt.Sprintf("%s:%s", prs.RepoOwner, pr.Branch),
+		Base:  pr.Base,
+	}
+	open, _, err := prs.Client.PullRequests.List(prs.RepoOwner, prs.RepoName, &opts)
+	if err != nil || len(open) == 0 {
+		return nil, err
+	}
+	return &open[0], nil
+}
+
+// Open creates the pull request (or updates the existing one) and makes sure
+// that it has the desired labels and reviewers
+func (prs *PullRequestService) Open(pr *pullRequest, existing *github.PullRequest) error {
+	var err error
+	if existing == nil {
+		existing, _, err = prs.Client.PullRequests.Create(prs.RepoOwner, prs.RepoName, &github.NewPullRequest{
+			Title: &pr.Title,
+			Head:  &pr.Branch,
+			Base:  &pr.Base,
+			Body:  &pr.Body,
+		})
+	} else if *existing.Title != pr.Title || existing.Body == nil || *existing.Body != pr.Body {
+		existing, _, err = prs.Client.PullRequests.Edit(prs.RepoOwner, prs.RepoName, *existing.Number, &github.PullRequest{
+			Title: &pr.Title,
+			Body:  &pr.Body,
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(pr.Labels) > 0 {
+		if _, _, err := prs.Client.Issues.AddLabelsToIssue(prs.RepoOwner, prs.RepoName, *existing.Number, pr.Labels); err != nil {
+			return err
+		}
+	}
+
+	if len(pr.Reviewers) > 0 {
+		path := fmt.Sprintf("repos/%s/%s/pulls/%d/requested_reviewers", prs.RepoOwner, prs.RepoName, *existing.Number)
+		req, err := prs.Client.NewRequest("POST", path, map[string][]string{"reviewers": pr.Reviewers})
+		if err != nil {
+			return err
+		}
+		if _, err := prs.Client.Do(req, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pullRequestChange reports whether delivering changes will open a new pull
+// request or add to an existing one
+func pullRequestChange(pr *pullRequest, existing *github.PullRequest) hubbub.Change {
+	change := hubbub.Change{Resource: pr.resource(), Action: hubbub.Create, After: pr.Title}
+	if existing != nil {
+		change.Action = hubbub.Update
+		change.Before = *existing.Title
+	}
+	return change
+}
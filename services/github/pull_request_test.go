@@ -0,0 +1,86 @@
+package github_service
+
+import (
+	"github.com/google/go-github/github"
+	hubbub "github.com/rjz/hubbub/common"
+	"testing"
+)
+
+func TestNewPullRequestDefaults(t *testing.T) {
+	pr := newPullRequest("heads/master", &pullRequestParams{Labels: []string{"hubbub"}})
+	if pr.Branch != defaultPullRequestBranch || pr.Title != defaultPullRequestTitle {
+		t.Error("expected default branch and title, got", pr.Branch, pr.Title)
+	}
+
+	if pr.Base != "master" {
+		t.Error("expected base branch 'master', got", pr.Base)
+	}
+
+	if pr.ref() != "heads/hubbub/policy" {
+		t.Error("expected branch ref, got", pr.ref())
+	}
+}
+
+func TestFileParamsTarget(t *testing.T) {
+	params := fileParams{Ref: hubbub.String("heads/master")}
+	if params.target() != "heads/master" {
+		t.Error("expected changes to be committed to ref, got", params.target())
+	}
+
+	params.PullRequest = &pullRequestParams{Branch: "policy-updates"}
+	if params.target() != "heads/policy-updates" {
+		t.Error("expected changes to be committed to the pull request's branch, got", params.target())
+	}
+}
+
+func TestPullRequestChange(t *testing.T) {
+	pr := newPullRequest("heads/master", &pullRequestParams{})
+	if change := pullRequestChange(pr, nil); change.Action != hubbub.Create {
+		t.Error("expected a new pull request, got", change)
+	}
+
+	existing := github.PullRequest{Number: hubbub.Int(4), Title: hubbub.String("Apply hubbub policy")}
+	change := pullRequestChange(pr, &existing)
+	if change.Action != hubbub.Update || change.Resource != "pull request from 'hubbub/policy' into 'master'" {
+		t.Error("expected the open pull request to be updated, got", change)
+	}
+}
+
+func TestWithPullRequestReportsOnce(t *testing.T) {
+	s := GithubService{FileService: NewFileService(nil, "rjz", "uno", true, false)}
+	prChange := pullRequestChange(newPullRequest("heads/master", &pullRequestParams{}), nil)
+
+	unchanged := hubbub.Change{Resource: "README.md", Action: hubbub.Unchanged}
+	if changes, _ := s.withPullRequest(&unchanged, nil, &prChange); len(changes) != 1 {
+		t.Error("expected unchanged file not to report pull request, got", changes)
+	}
+
+	license := hubbub.Change{Resource: "LICENSE", Action: hubbub.Create}
+	changes, _ := s.withPullRequest(&license, nil, &prChange)
+	if len(changes) != 2 || changes[1].Resource != prChange.Resource {
+		t.Error("expected first changed file to report pull request, got", changes)
+	}
+
+	notice := hubbub.Change{Resource: "NOTICE", Action: hubbub.Create}
+	if changes, _ := s.withPullRequest(&notice, nil, &prChange); len(changes) != 1 {
+		t.Error("expected pull request to be reported once, got", changes)
+	}
+}
+
+func TestWithPullRequestReportsOpenPullRequestInDryRun(t *testing.T) {
+	pr := newPullRequest("heads/master", &pullRequestParams{})
+	existing := github.PullRequest{Number: hubbub.Int(4), Title: hubbub.String("Apply hubbub policy")}
+	prChange := pullRequestChange(pr, &existing)
+	unchanged := hubbub.Change{Resource: "README.md", Action: hubbub.Unchanged}
+
+	s := GithubService{FileService: NewFileService(nil, "rjz", "uno", false, false)}
+	if changes, _ := s.withPullRequest(&unchanged, nil, &prChange); len(changes) != 1 {
+		t.Error("expected open pull request to be ignored when applying, got", changes)
+	}
+
+	s = GithubService{DryRun: true, FileService: NewFileService(nil, "rjz", "uno", true, false)}
+	changes, _ := s.withPullRequest(&unchanged, nil, &prChange)
+	if len(changes) != 2 || changes[1].Action != hubbub.Update {
+		t.Error("expected open pull request to be reported as drift, got", changes)
+	}
+}
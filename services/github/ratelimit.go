@@ -0,0 +1,97 @@
+package github_service
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimitReserve is the number of requests held back from github's budget
+// to cover requests already in flight when the limit is reached
+const rateLimitReserve = 50
+
+// RateLimiter tracks github's rate limit across all sessions and pauses
+// requests when the remaining budget runs low
+type RateLimiter struct {
+	mu        sync.Mutex
+	reserve   int
+	remaining int
+	reset     time.Time
+	known     bool
+
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// NewRateLimiter creates a limiter that pauses once fewer than reserve
+// requests remain
+func NewRateLimiter(reserve int) *RateLimiter {
+	return &RateLimiter{reserve: reserve, now: time.Now, sleep: time.Sleep}
+}
+
+// Update records the budget reported by a github response
+func (rl *RateLimiter) Update(h http.Header) {
+	remaining, remainingErr := strconv.Atoi(h.Get("X-RateLimit-Remaining"))
+	reset, resetErr := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64)
+	if remainingErr != nil || resetErr != nil {
+		return
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	resetAt := time.Unix(reset, 0)
+	// responses may arrive out of order; keep the most pessimistic count
+	// within a window, and start over when the window resets
+	if !rl.known || resetAt.After(rl.reset) || remaining < rl.remaining {
+		rl.remaining = remaining
+		rl.reset = resetAt
+		rl.known = true
+	}
+}
+
+// delay returns how long a request must wait for the budget to reset
+func (rl *RateLimiter) delay() time.Duration {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if !rl.known || rl.remaining > rl.reserve {
+		return 0
+	}
+
+	wait := rl.reset.Sub(rl.now())
+	if wait <= 0 {
+		// the window has reset; the next response will tell us the new budget
+		rl.known = false
+		return 0
+	}
+	return wait
+}
+
+// Wait blocks until the budget allows another request
+func (rl *RateLimiter) Wait() {
+	if wait := rl.delay(); wait > 0 {
+		log.Printf("github rate limit nearly exhausted; pausing for %s", wait)
+		rl.sleep(wait)
+	}
+}
+
+// rateLimitedTransport consults a RateLimiter before each request
+type rateLimitedTransport struct {
+	base    http.RoundTripper
+	limiter *RateLimiter
+}
+
+func (t *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.limiter.Wait()
+	resp, err := t.base.RoundTrip(req)
+	if err == nil {
+		t.limiter.Update(resp.Header)
+	}
+	return resp, err
+}
+
+// sharedRateLimiter is used by every session's github client
+var sharedRateLimiter = NewRateLimiter(rateLimitReserve)
@@ -0,0 +1,68 @@
+package github_service
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func rateLimiterFixture(now time.Time, slept *time.Duration) *RateLimiter {
+	rl := NewRateLimiter(10)
+	rl.now = func() time.Time { return now }
+	rl.sleep = func(d time.Duration) { *slept += d }
+	return rl
+}
+
+func rateLimitHeader(remaining int, reset time.Time) http.Header {
+	h := http.Header{}
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	h.Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+	return h
+}
+
+func TestRateLimiterUnknownBudget(t *testing.T) {
+	var slept time.Duration
+	rl := rateLimiterFixture(time.Unix(1000, 0), &slept)
+	rl.Wait()
+	if slept != 0 {
+		t.Error("expected no pause, got", slept)
+	}
+}
+
+func TestRateLimiterPausesWhenLow(t *testing.T) {
+	var slept time.Duration
+	now := time.Unix(1000, 0)
+	rl := rateLimiterFixture(now, &slept)
+
+	rl.Update(rateLimitHeader(5, now.Add(time.Minute)))
+	rl.Wait()
+	if slept != time.Minute {
+		t.Error("expected 1m pause, got", slept)
+	}
+}
+
+func TestRateLimiterIgnoresStaleResponses(t *testing.T) {
+	var slept time.Duration
+	now := time.Unix(1000, 0)
+	rl := rateLimiterFixture(now, &slept)
+
+	rl.Update(rateLimitHeader(5, now.Add(time.Minute)))
+	rl.Update(rateLimitHeader(500, now.Add(time.Minute)))
+	rl.Wait()
+	if slept != time.Minute {
+		t.Error("expected 1m pause, got", slept)
+	}
+}
+
+func TestRateLimiterResumesAfterReset(t *testing.T) {
+	var slept time.Duration
+	now := time.Unix(1000, 0)
+	rl := rateLimiterFixture(now, &slept)
+
+	rl.Update(rateLimitHeader(5, now.Add(-time.Second)))
+	rl.Wait()
+	if slept != 0 {
+		t.Error("expected no pause, got", slept)
+	}
+}
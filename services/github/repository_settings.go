@@ -0,0 +1,107 @@
+package github_service
+
+import (
+	"fmt"
+	"github.com/google/go-github/github"
+	hubbub "github.com/rjz/hubbub/common"
+)
+
+// RepositorySettings describe a github repository. Settings that are omitted
+// are left alone.
+type RepositorySettings struct {
+	Description         *string `json:"description,omitempty"`
+	Homepage            *string `json:"homepage,omitempty"`
+	Visibility          *string `json:"visibility,omitempty"`
+	DefaultBranch       *string `json:"default_branch,omitempty"`
+	HasIssues           *bool   `json:"has_issues,omitempty"`
+	HasWiki             *bool   `json:"has_wiki,omitempty"`
+	HasProjects         *bool   `json:"has_projects,omitempty"`
+	AllowMergeCommit    *bool   `json:"allow_merge_commit,omitempty"`
+	AllowSquashMerge    *bool   `json:"allow_squash_merge,omitempty"`
+	AllowRebaseMerge    *bool   `json:"allow_rebase_merge,omitempty"`
+	DeleteBranchOnMerge *bool   `json:"delete_branch_on_merge,omitempty"`
+}
+
+// repositoryResponse is the subset of github's repository representation
+// describing its settings
+type repositoryResponse struct {
+	RepositorySettings
+	Private *bool `json:"private,omitempty"`
+}
+
+// settings returns the repository's settings, deriving its visibility from
+// `private` if github didn't report it
+func (r *repositoryResponse) settings() *RepositorySettings {
+	settings := r.RepositorySettings
+	if settings.Visibility == nil && r.Private != nil {
+		if *r.Private {
+			settings.Visibility = hubbub.String("private")
+		} else {
+			settings.Visibility = hubbub.String("public")
+		}
+	}
+	return &settings
+}
+
+type RepositorySettingsService struct {
+	Client    *github.Client
+	RepoOwner string
+	RepoName  string
+	DryRun    bool
+}
+
+func NewRepositorySettingsService(client *github.Client, owner, name string, dryRun bool) *RepositorySettingsService {
+	return &RepositorySettingsService{client, owner, name, dryRun}
+}
+
+// path locates the repository in github's API
+func (rss *RepositorySettingsService) path() string {
+	return fmt.Sprintf("repos/%s/%s", rss.RepoOwner, rss.RepoName)
+}
+
+// Get fetches the repository's current settings
+func (rss *RepositorySettingsService) Get() (*RepositorySettings, error) {
+	req, err := rss.Client.NewRequest("GET", rss.path(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := repositoryResponse{}
+	if _, err := rss.Client.Do(req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.settings(), nil
+}
+
+// Update changes any settings that differ from desired
+func (rss *RepositorySettingsService) Update(desired *RepositorySettings) (*hubbub.Change, error) {
+	current, err := rss.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	change := hubbub.Change{Resource: "settings", Action: hubbub.Update, Before: current, After: desired}
+	if hubbub.SettingsMatch(current, desired) {
+		change.Action = hubbub.Unchanged
+		return &change, nil
+	}
+
+	if rss.DryRun {
+		return &change, nil
+	}
+
+	// github requires the repository's name with every update
+	body, err := hubbub.SettingsValues(desired)
+	if err != nil {
+		return nil, err
+	}
+	body["name"] = rss.RepoName
+
+	req, err := rss.Client.NewRequest("PATCH", rss.path(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	_, updateErr := rss.Client.Do(req, nil)
+	return &change, updateErr
+}
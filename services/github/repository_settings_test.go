@@ -0,0 +1,37 @@
+package github_service
+
+import (
+	"encoding/json"
+	hubbub "github.com/rjz/hubbub/common"
+	"testing"
+)
+
+func TestRepositoryResponseSettings(t *testing.T) {
+	resp := repositoryResponse{}
+	json.Unmarshal([]byte(`{"name":"uno","private":true,"has_wiki":true}`), &resp)
+
+	settings := resp.settings()
+	if settings.Visibility == nil || *settings.Visibility != "private" {
+		t.Error("expected visibility to be derived from private, got", settings.Visibility)
+	}
+}
+
+func TestRepositorySettingsMatch(t *testing.T) {
+	current := RepositorySettings{
+		Description: hubbub.String("uno"),
+		HasWiki:     hubbub.Bool(true),
+		HasIssues:   hubbub.Bool(true),
+	}
+
+	if !hubbub.SettingsMatch(&current, &RepositorySettings{HasWiki: hubbub.Bool(true)}) {
+		t.Error("expected specified settings to match")
+	}
+
+	if hubbub.SettingsMatch(&current, &RepositorySettings{HasWiki: hubbub.Bool(false)}) {
+		t.Error("expected has_wiki to differ")
+	}
+
+	if hubbub.SettingsMatch(&current, &RepositorySettings{Homepage: hubbub.String("https://example.com")}) {
+		t.Error("expected homepage to differ")
+	}
+}
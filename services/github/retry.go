@@ -0,0 +1,106 @@
+package github_service
+
+import (
+	"errors"
+	hubbub "github.com/rjz/hubbub/common"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// errRetryableStatus marks a response that should be retried
+var errRetryableStatus = errors.New("retryable response status")
+
+// idempotentMethods may be repeated without changing their outcome
+var idempotentMethods = map[string]bool{
+	"GET":    true,
+	"HEAD":   true,
+	"PUT":    true,
+	"PATCH":  true,
+	"DELETE": true,
+}
+
+// isRateLimited reports whether github rejected a request for running out of
+// rate limit (which the RateLimiter will wait out before the next attempt)
+func isRateLimited(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusForbidden && resp.Header.Get("X-RateLimit-Remaining") == "0"
+}
+
+// retryableResponse reports whether github's response indicates a transient
+// failure, including running out of rate limit
+func retryableResponse(resp *http.Response) bool {
+	return hubbub.RetryableStatus(resp.StatusCode) || isRateLimited(resp)
+}
+
+// retryingTransport retries requests that fail for transient reasons
+type retryingTransport struct {
+	base   http.RoundTripper
+	policy *hubbub.RetryPolicy
+}
+
+func (t *retryingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil && req.GetBody == nil {
+		// the body can't be replayed, so the request can't be retried
+		return t.base.RoundTrip(req)
+	}
+
+	// A request that isn't idempotent (e.g. a POST creating a commit) may
+	// have been applied even if it failed, so it's only retried if github
+	// rejected it outright
+	idempotent := idempotentMethods[req.Method]
+
+	var resp *http.Response
+	err := t.policy.Do(func(err error) bool {
+		if !idempotent {
+			return err == errRetryableStatus
+		}
+		return err == errRetryableStatus || hubbub.RetryableError(err)
+	}, func() error {
+		if resp != nil {
+			discard(resp)
+			resp = nil
+		}
+
+		attempt, err := rewind(req)
+		if err != nil {
+			return err
+		}
+
+		if resp, err = t.base.RoundTrip(attempt); err != nil {
+			return err
+		}
+
+		if isRateLimited(resp) || (idempotent && retryableResponse(resp)) {
+			return errRetryableStatus
+		}
+		return nil
+	})
+
+	if err == errRetryableStatus {
+		// out of attempts: hand the final response to the caller
+		return resp, nil
+	}
+	return resp, err
+}
+
+// rewind prepares a request to be (re-)sent with a fresh copy of its body
+func rewind(req *http.Request) (*http.Request, error) {
+	if req.Body == nil {
+		return req, nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+
+	attempt := *req
+	attempt.Body = body
+	return &attempt, nil
+}
+
+// discard releases a response that won't be returned to the caller
+func discard(resp *http.Response) {
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+}
@@ -0,0 +1,159 @@
+package github_service
+
+import (
+	"errors"
+	hubbub "github.com/rjz/hubbub/common"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// roundTripFunc stubs a transport
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func responseFixture(status int) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	}
+}
+
+func retryingTransportFixture(statuses ...int) (*retryingTransport, *[]string) {
+	var bodies []string
+	t := &retryingTransport{
+		base: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Body != nil {
+				data, _ := ioutil.ReadAll(req.Body)
+				bodies = append(bodies, string(data))
+			}
+			status := statuses[0]
+			statuses = statuses[1:]
+			return responseFixture(status), nil
+		}),
+		policy: &hubbub.RetryPolicy{Attempts: 3},
+	}
+	return t, &bodies
+}
+
+func TestRetryingTransportRetriesServerErrors(t *testing.T) {
+	rt, bodies := retryingTransportFixture(502, 503, 200)
+	req, _ := http.NewRequest("PATCH", "https://api.github.com/", strings.NewReader("body"))
+
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != 200 {
+		t.Error("expected 200, got", resp.StatusCode)
+	}
+
+	if len(*bodies) != 3 || (*bodies)[2] != "body" {
+		t.Error("expected body to be resent on each attempt, got", *bodies)
+	}
+}
+
+func TestRetryingTransportReturnsFinalResponse(t *testing.T) {
+	rt, _ := retryingTransportFixture(500, 500, 500)
+	req, _ := http.NewRequest("GET", "https://api.github.com/", nil)
+
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != 500 {
+		t.Error("expected 500, got", resp.StatusCode)
+	}
+}
+
+func TestRetryingTransportSkipsClientErrors(t *testing.T) {
+	rt, _ := retryingTransportFixture(404, 200)
+	req, _ := http.NewRequest("GET", "https://api.github.com/", nil)
+
+	resp, _ := rt.RoundTrip(req)
+	if resp.StatusCode != 404 {
+		t.Error("expected 404, got", resp.StatusCode)
+	}
+}
+
+func TestRetryingTransportDoesNotRepeatPosts(t *testing.T) {
+	rt, bodies := retryingTransportFixture(502, 200)
+	req, _ := http.NewRequest("POST", "https://api.github.com/", strings.NewReader("body"))
+
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != 502 || len(*bodies) != 1 {
+		t.Error("expected POST to be sent once, got", resp.StatusCode, "after", len(*bodies), "attempts")
+	}
+}
+
+func TestRetryingTransportDoesNotRepeatFailedPosts(t *testing.T) {
+	attempts := 0
+	rt := &retryingTransport{
+		base: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			attempts++
+			return nil, &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}
+		}),
+		policy: &hubbub.RetryPolicy{Attempts: 3},
+	}
+	req, _ := http.NewRequest("POST", "https://api.github.com/", strings.NewReader("body"))
+
+	if _, err := rt.RoundTrip(req); err == nil {
+		t.Error("expected error, didn't get it.")
+	}
+
+	if attempts != 1 {
+		t.Error("expected POST to be sent once, got", attempts)
+	}
+}
+
+func TestRetryingTransportRetriesRateLimitedPosts(t *testing.T) {
+	limited := responseFixture(403)
+	limited.Header.Set("X-RateLimit-Remaining", "0")
+	responses := []*http.Response{limited, responseFixture(201)}
+
+	var bodies []string
+	rt := &retryingTransport{
+		base: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			data, _ := ioutil.ReadAll(req.Body)
+			bodies = append(bodies, string(data))
+			resp := responses[0]
+			responses = responses[1:]
+			return resp, nil
+		}),
+		policy: &hubbub.RetryPolicy{Attempts: 3},
+	}
+	req, _ := http.NewRequest("POST", "https://api.github.com/", strings.NewReader("body"))
+
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != 201 || len(bodies) != 2 {
+		t.Error("expected rejected POST to be resent, got", resp.StatusCode, "after", len(bodies), "attempts")
+	}
+}
+
+func TestRetryableResponseRateLimited(t *testing.T) {
+	resp := responseFixture(403)
+	if retryableResponse(resp) {
+		t.Error("expected forbidden response not to be retried")
+	}
+
+	resp.Header.Set("X-RateLimit-Remaining", "0")
+	if !retryableResponse(resp) {
+		t.Error("expected rate-limited response to be retried")
+	}
+}
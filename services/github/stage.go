@@ -0,0 +1,250 @@
+package github_service
+
+import (
+	"fmt"
+	"github.com/google/go-github/github"
+	util "github.com/rjz/hubbub/common"
+	"path"
+	"sort"
+	"strings"
+)
+
+// stagedFile is a change to a file waiting to be committed
+type stagedFile struct {
+	Path string
+	Mode *string
+
+	// Content is nil if the file is to be removed
+	Content *string
+}
+
+// stage collects changes to the files on a ref so that they can be committed
+// together
+type stage struct {
+	ref       string
+	parentSHA sha
+
+	// pullRequest proposes the changes for review, if they aren't committed
+	// to ref directly
+	pullRequest *pullRequest
+
+	// tree is the (recursive) tree of the parent commit
+	tree *github.Tree
+
+	files    map[string]*stagedFile
+	order    []string
+	messages []string
+}
+
+func newStage(ref string, parentSHA sha, tree *github.Tree, pr *pullRequest) *stage {
+	return &stage{ref: ref, parentSHA: parentSHA, pullRequest: pr, tree: tree, files: map[string]*stagedFile{}}
+}
+
+// lookup finds the entry for filepath, taking staged changes into account
+func (st *stage) lookup(filepath string) *github.TreeEntry {
+	if f, ok := st.files[filepath]; ok {
+		if f.Content == nil {
+			return nil
+		}
+		return &github.TreeEntry{Path: &f.Path, Mode: f.Mode, Type: util.String("blob"), SHA: util.String(blobSHA(*f.Content))}
+	}
+	return findByPath(st.tree.Entries, filepath)
+}
+
+// add stages a change to a file
+func (st *stage) add(f stagedFile, msg string) {
+	if _, ok := st.files[f.Path]; !ok {
+		st.order = append(st.order, f.Path)
+	}
+	st.files[f.Path] = &f
+	st.messages = append(st.messages, msg)
+}
+
+// isEmpty reports whether there's anything to commit
+func (st *stage) isEmpty() bool {
+	return len(st.order) == 0
+}
+
+// message describes the staged changes
+func (st *stage) message() string {
+	if len(st.messages) == 1 {
+		return st.messages[0]
+	}
+	return fmt.Sprintf("Updating %d files\n\n%s", len(st.order), strings.Join(st.messages, "\n"))
+}
+
+// hasRemovals reports whether any staged change removes a file
+func (st *stage) hasRemovals() bool {
+	for _, f := range st.files {
+		if f.Content == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// depth counts the directories above a path ("" is the root)
+func depth(dir string) int {
+	if dir == "" {
+		return 0
+	}
+	return strings.Count(dir, "/") + 1
+}
+
+// dirtyDirs lists the directories containing staged changes, deepest first
+func (st *stage) dirtyDirs() []string {
+	dirty := map[string]bool{}
+	for _, p := range st.order {
+		for dir := parentDir(p); ; dir = parentDir(dir) {
+			dirty[dir] = true
+			if dir == "" {
+				break
+			}
+		}
+	}
+
+	var dirs []string
+	for dir := range dirty {
+		dirs = append(dirs, dir)
+	}
+	sort.Sort(deepestFirst(dirs))
+	return dirs
+}
+
+type deepestFirst []string
+
+func (a deepestFirst) Len() int      { return len(a) }
+func (a deepestFirst) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a deepestFirst) Less(i, j int) bool {
+	if depth(a[i]) != depth(a[j]) {
+		return depth(a[i]) > depth(a[j])
+	}
+	return a[i] < a[j]
+}
+
+// listDir finds the SHA and entries of the directory dir in the parent
+// commit's tree, or nil if it doesn't exist. Directories are listed one level
+// at a time: github truncates recursive listings of large trees, and a
+// directory rebuilt from a truncated listing would lose the missing entries.
+func (st *stage) listDir(fs *FileService, dir string) (*string, []github.TreeEntry, error) {
+	SHA := st.tree.SHA
+	entries, err := getTree(fs, *SHA)
+	if err != nil || dir == "" {
+		return SHA, entries, err
+	}
+
+	for _, name := range strings.Split(dir, "/") {
+		var next *github.TreeEntry
+		for i, e := range entries {
+			if *e.Path == name && *e.Type == "tree" {
+				next = &entries[i]
+				break
+			}
+		}
+		if next == nil {
+			return nil, nil, nil
+		}
+
+		SHA = next.SHA
+		if entries, err = getTree(fs, *SHA); err != nil {
+			return nil, nil, err
+		}
+	}
+	return SHA, entries, nil
+}
+
+// build creates a tree containing the staged changes, returning its SHA.
+//
+// Only the ancestors of staged files are rebuilt. Where possible each is
+// rebuilt from the existing directory, listing just the entries that changed;
+// directories that lose an entry (or that are new) must be listed in full.
+// Directories left empty are removed.
+func (st *stage) build(fs *FileService) (*string, error) {
+	if !st.hasRemovals() {
+		// Github creates (or reuses) the ancestors of nested paths added to an
+		// existing tree
+		var entries []github.TreeEntry
+		for _, p := range st.order {
+			f := st.files[p]
+			entries = append(entries, github.TreeEntry{Path: &f.Path, Mode: f.Mode, Type: util.String("blob"), Content: f.Content})
+		}
+		return createTree(fs, *st.tree.SHA, entries)
+	}
+
+	built := map[string]*string{}
+	for _, dir := range st.dirtyDirs() {
+		// collect the changed children of dir, with nil marking removals
+		var names []string
+		changed := map[string]*github.TreeEntry{}
+		for _, p := range st.order {
+			if f := st.files[p]; parentDir(p) == dir {
+				name := path.Base(p)
+				names = append(names, name)
+				if f.Content != nil {
+					changed[name] = &github.TreeEntry{Path: util.String(name), Mode: f.Mode, Type: util.String("blob"), Content: f.Content}
+				} else {
+					changed[name] = nil
+				}
+			}
+		}
+		for sub, SHA := range built {
+			if sub != "" && parentDir(sub) == dir {
+				name := path.Base(sub)
+				names = append(names, name)
+				if SHA != nil {
+					changed[name] = &github.TreeEntry{Path: util.String(name), Mode: util.String("040000"), Type: util.String("tree"), SHA: SHA}
+				} else {
+					changed[name] = nil
+				}
+			}
+		}
+		sort.Strings(names)
+
+		baseSHA, existing, err := st.listDir(fs, dir)
+		if err != nil {
+			return nil, err
+		}
+
+		listAll := baseSHA == nil
+		for _, e := range changed {
+			listAll = listAll || e == nil
+		}
+
+		var entries []github.TreeEntry
+		if !listAll {
+			for _, name := range names {
+				entries = append(entries, *changed[name])
+			}
+			SHA, err := createTree(fs, *baseSHA, entries)
+			if err != nil {
+				return nil, err
+			}
+			built[dir] = SHA
+			continue
+		}
+
+		for _, e := range existing {
+			if _, ok := changed[*e.Path]; ok {
+				continue
+			}
+			entries = append(entries, github.TreeEntry{Path: e.Path, Mode: e.Mode, Type: e.Type, SHA: e.SHA})
+		}
+		for _, name := range names {
+			if e := changed[name]; e != nil {
+				entries = append(entries, *e)
+			}
+		}
+
+		if len(entries) == 0 && dir != "" {
+			built[dir] = nil
+			continue
+		}
+
+		SHA, err := createTree(fs, "", entries)
+		if err != nil {
+			return nil, err
+		}
+		built[dir] = SHA
+	}
+	return built[""], nil
+}
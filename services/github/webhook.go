@@ -2,7 +2,10 @@ package github_service
 
 import (
 	"errors"
+	"fmt"
 	"github.com/google/go-github/github"
+	hubbub "github.com/rjz/hubbub/common"
+	"sort"
 )
 
 type HookService struct {
@@ -10,10 +13,11 @@ type HookService struct {
 	RepoOwner string
 	RepoName  string
 	Hooks     *[]github.Hook
+	DryRun    bool
 }
 
-func NewHookService(client *github.Client, owner, name string) (*HookService, error) {
-	hs := HookService{client, owner, name, nil}
+func NewHookService(client *github.Client, owner, name string, dryRun bool) (*HookService, error) {
+	hs := HookService{client, owner, name, nil, dryRun}
 
 	hooks, _, err := hs.Client.Repositories.ListHooks(hs.RepoOwner, hs.RepoName, &github.ListOptions{})
 	if err != nil {
@@ -37,31 +41,101 @@ func (hs *HookService) byUrl(url string) (*github.Hook, error) {
 	return nil, nil
 }
 
-func (hs *HookService) CreateOrUpdate(params *github.Hook) error {
+// sortedEvents returns a sorted copy of a hook's events
+func sortedEvents(h *github.Hook) []string {
+	events := append([]string{}, h.Events...)
+	sort.Strings(events)
+	return events
+}
+
+// hookMatches compares the settings of an existing hook with the desired
+// settings. Github masks secrets, so they can't be compared.
+func hookMatches(existing, desired *github.Hook) bool {
+	if desired.Active != nil && (existing.Active == nil || *existing.Active != *desired.Active) {
+		return false
+	}
+
+	if desired.Events != nil && fmt.Sprint(sortedEvents(existing)) != fmt.Sprint(sortedEvents(desired)) {
+		return false
+	}
+
+	for k, v := range desired.Config {
+		if k == "secret" {
+			continue
+		}
+		if fmt.Sprint(existing.Config[k]) != fmt.Sprint(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// redact copies a hook, masking its secret the same way github does
+func redact(h *github.Hook) *github.Hook {
+	if h == nil {
+		return nil
+	}
+
+	copied := *h
+	copied.Config = map[string]interface{}{}
+	for k, v := range h.Config {
+		if k == "secret" {
+			v = "********"
+		}
+		copied.Config[k] = v
+	}
+	return &copied
+}
+
+func (hs *HookService) CreateOrUpdate(params *github.Hook) (*hubbub.Change, error) {
 	hookUrl := params.Config["url"].(string)
 	hook, err := hs.byUrl(hookUrl)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	change := hubbub.Change{Resource: hookUrl, Before: redact(hook), After: redact(params)}
 	if hook == nil {
+		change.Action = hubbub.Create
+		if hs.DryRun {
+			return &change, nil
+		}
 		_, _, err := hs.Client.Repositories.CreateHook(hs.RepoOwner, hs.RepoName, params)
-		return err
+		return &change, err
+	}
+
+	if hookMatches(hook, params) {
+		change.Action = hubbub.Unchanged
+		return &change, nil
+	}
+
+	change.Action = hubbub.Update
+	if hs.DryRun {
+		return &change, nil
 	}
 
 	_, _, updateErr := hs.Client.Repositories.EditHook(hs.RepoOwner, hs.RepoName, *hook.ID, params)
-	return updateErr
+	return &change, updateErr
 }
 
-func (hs *HookService) Remove(params *github.Hook) error {
-	hook, err := hs.byUrl(params.Config["url"].(string))
+func (hs *HookService) Remove(params *github.Hook) (*hubbub.Change, error) {
+	hookUrl := params.Config["url"].(string)
+	hook, err := hs.byUrl(hookUrl)
 	if err != nil {
-		return err
+		return nil, err
 	}
+
+	change := hubbub.Change{Resource: hookUrl, Before: redact(hook)}
 	if hook == nil {
-		return nil
+		change.Action = hubbub.Unchanged
+		return &change, nil
+	}
+
+	change.Action = hubbub.Delete
+	if hs.DryRun {
+		return &change, nil
 	}
 
 	_, deleteErr := hs.Client.Repositories.DeleteHook(hs.RepoOwner, hs.RepoName, *hook.ID)
-	return deleteErr
+	return &change, deleteErr
 }
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/rjz/go-travis/travis"
+	hubbub "github.com/rjz/hubbub/common"
 )
 
 // Wraps environment variable list for a repo
@@ -11,16 +12,22 @@ type EnvVarService struct {
 	client *travis.Client
 	repoID int
 	vars   *[]travis.EnvironmentVariable
+	dryRun bool
+	retry  *hubbub.RetryPolicy
 }
 
 // NewEnvVarService configures a new EnvVarService using the specified client
-// and travis-ci repoId
-func NewEnvVarService(client *travis.Client, repoId int) (*EnvVarService, error) {
-	vars, err := client.ListEnvironmentVariables(repoId)
+// and travis-ci repoId. When dryRun is set, changes are reported but not made.
+func NewEnvVarService(client *travis.Client, repoId int, dryRun bool, retry *hubbub.RetryPolicy) (*EnvVarService, error) {
+	var vars []travis.EnvironmentVariable
+	err := retry.Do(hubbub.RetryableError, func() (err error) {
+		vars, err = client.ListEnvironmentVariables(repoId)
+		return
+	})
 	if err != nil {
 		return nil, err
 	}
-	return &EnvVarService{client, repoId, &vars}, nil
+	return &EnvVarService{client, repoId, &vars, dryRun, retry}, nil
 }
 
 // byName returns environment variables matching (case-sensitive) name
@@ -35,42 +42,72 @@ func (evs *EnvVarService) byName(name string) []*travis.EnvironmentVariable {
 	return matches
 }
 
+// envVarMatches compares an existing variable with the desired one. Travis
+// doesn't reveal the values of private variables, so these never match.
+func envVarMatches(existing, desired *travis.EnvironmentVariable) bool {
+	if existing.Value == nil || desired.Value == nil || *existing.Value != *desired.Value {
+		return false
+	}
+
+	existingPublic := existing.Public != nil && *existing.Public
+	desiredPublic := desired.Public != nil && *desired.Public
+	return existingPublic == desiredPublic
+}
+
 // Create a new environment variable
-func (evs *EnvVarService) create(ev *travis.EnvironmentVariable) error {
+func (evs *EnvVarService) create(ev *travis.EnvironmentVariable) (*hubbub.Change, error) {
+	change := hubbub.Change{Resource: *ev.Name, Action: hubbub.Create}
+	if evs.dryRun {
+		return &change, nil
+	}
+
+	// not retried: a request that failed may still have created the variable,
+	// and travis would happily create a duplicate
 	_, err := evs.client.CreateEnvironmentVariable(evs.repoID, ev)
 	if err == nil {
 		// Add new var to internal list
 		newVars := append(*evs.vars, *ev)
 		evs.vars = &newVars
 	}
-	return err
+	return &change, err
 }
 
 // CreateOrUpdate sets an environment variable
 //
 // If the environment variable has multiple definitions, the update will
 // overwrite the most recent entry and all other entries will be removed
-func (evs *EnvVarService) CreateOrUpdate(ev *travis.EnvironmentVariable) error {
+func (evs *EnvVarService) CreateOrUpdate(ev *travis.EnvironmentVariable) ([]hubbub.Change, error) {
 	existingVars := evs.byName(*ev.Name)
 	if len(existingVars) == 0 {
-		return evs.create(ev)
+		change, err := evs.create(ev)
+		return []hubbub.Change{*change}, err
 	}
 
 	// Travis doesn't enforce uniqueness on variable names: pop latest and
 	// prepare list of dups for deletion.
 	existingVar, dups := existingVars[len(existingVars)-1], existingVars[:len(existingVars)-1]
 
-	// Update internal var
-	existingVar.Value = ev.Value
-	existingVar.Public = ev.Public
+	change := hubbub.Change{Resource: *ev.Name, Action: hubbub.Update}
+	if envVarMatches(existingVar, ev) {
+		change.Action = hubbub.Unchanged
+	} else if !evs.dryRun {
+		// Update internal var
+		existingVar.Value = ev.Value
+		existingVar.Public = ev.Public
 
-	// Update remote var
-	if _, err := evs.client.UpdateEnvironmentVariable(evs.repoID, *existingVar.ID, existingVar); err != nil {
-		return err
+		// Update remote var
+		err := evs.retry.Do(hubbub.RetryableError, func() error {
+			_, err := evs.client.UpdateEnvironmentVariable(evs.repoID, *existingVar.ID, existingVar)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// TODO: We know IDs in advance and can run requests in parallel. We should.
-	return evs.removeAll(dups)
+	removed, err := evs.removeAll(dups)
+	return append([]hubbub.Change{change}, removed...), err
 }
 
 // removeInternalById omits a var from the internal list
@@ -83,26 +120,43 @@ func (evs *EnvVarService) removeInternalById(id string) error {
 			return nil
 		}
 	}
-	return errors.New(fmt.Sprintf("var '%d' does not exist", id))
+	return errors.New(fmt.Sprintf("var '%s' does not exist", id))
 }
 
 // removeAll removes all vars from the list
-func (evs *EnvVarService) removeAll(vars []*travis.EnvironmentVariable) error {
+func (evs *EnvVarService) removeAll(vars []*travis.EnvironmentVariable) ([]hubbub.Change, error) {
+	var changes []hubbub.Change
 	for _, v := range vars {
+		changes = append(changes, hubbub.Change{
+			Resource: fmt.Sprintf("%s (%s)", *v.Name, *v.ID),
+			Action:   hubbub.Delete,
+		})
+
+		if evs.dryRun {
+			continue
+		}
+
 		// Remove internal var
 		if err := evs.removeInternalById(*v.ID); err != nil {
-			return err
+			return changes, err
 		}
 
 		// Destroy remote var
-		if err := evs.client.DestroyEnvironmentVariable(evs.repoID, *v.ID); err != nil {
-			return err
+		err := evs.retry.Do(hubbub.RetryableError, func() error {
+			return evs.client.DestroyEnvironmentVariable(evs.repoID, *v.ID)
+		})
+		if err != nil {
+			return changes, err
 		}
 	}
-	return nil
+	return changes, nil
 }
 
 // RemoveByName deletes one or more environment variables
-func (evs *EnvVarService) RemoveByName(name string) error {
-	return evs.removeAll(evs.byName(name))
+func (evs *EnvVarService) RemoveByName(name string) ([]hubbub.Change, error) {
+	changes, err := evs.removeAll(evs.byName(name))
+	if len(changes) == 0 {
+		changes = []hubbub.Change{{Resource: name, Action: hubbub.Unchanged}}
+	}
+	return changes, err
 }
@@ -68,3 +68,42 @@ func TestRemoveByInvalidId(t *testing.T) {
 		t.Error("Expected err, didn't get it.")
 	}
 }
+
+func TestEnvVarMatchesPublic(t *testing.T) {
+	existing := travis.EnvironmentVariable{Value: util.String("abc"), Public: util.Bool(true)}
+	desired := travis.EnvironmentVariable{Value: util.String("abc"), Public: util.Bool(true)}
+	if !envVarMatches(&existing, &desired) {
+		t.Error("expected match, didn't get it.")
+	}
+
+	desired.Value = util.String("def")
+	if envVarMatches(&existing, &desired) {
+		t.Error("expected mismatch, didn't get it.")
+	}
+}
+
+func TestEnvVarMatchesPrivate(t *testing.T) {
+	existing := travis.EnvironmentVariable{Public: util.Bool(false)}
+	desired := travis.EnvironmentVariable{Value: util.String("abc"), Public: util.Bool(false)}
+	if envVarMatches(&existing, &desired) {
+		t.Error("expected private vars to never match")
+	}
+}
+
+func TestRemoveByNameDryRun(t *testing.T) {
+	evs := evsFixture()
+	evs.dryRun = true
+
+	changes, err := evs.RemoveByName("xyz")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count := len(changes); count != 2 {
+		t.Error("expected 2, got", count)
+	}
+
+	if count := len(*evs.vars); count != 3 {
+		t.Error("expected dry run to leave vars intact, got", count)
+	}
+}
@@ -0,0 +1,58 @@
+package travis_service
+
+import (
+	hubbub "github.com/rjz/hubbub/common"
+)
+
+// envVarSchema describes a "travis_env_var" goal
+var envVarSchema = &hubbub.Schema{
+	Type:     "object",
+	Required: []string{"state", "name"},
+	Properties: map[string]*hubbub.Schema{
+		"state": {
+			Type:        "string",
+			Description: "one of `\"absent\"` OR `\"present\"`",
+			Enum:        []interface{}{"present", "absent"},
+		},
+		"name":   {Type: "string", Description: "the name of the variable to set"},
+		"value":  {Type: "string", Description: "the variable's value"},
+		"public": {Type: "boolean", Description: "whether the value is shown in build logs"},
+	},
+	AdditionalProperties: hubbub.Bool(false),
+}
+
+// repositorySettingsSchema describes a "travis_repository_settings" goal
+var repositorySettingsSchema = &hubbub.Schema{
+	Type: "object",
+	Properties: map[string]*hubbub.Schema{
+		"builds_only_with_travis_yml": {Type: "boolean", Description: "see API docs"},
+		"build_pushes":                {Type: "boolean", Description: "see API docs"},
+		"build_pull_requests":         {Type: "boolean", Description: "see API docs"},
+		"maximum_number_of_builds":    {Type: "integer", Description: "default: 0 (unlimited)"},
+	},
+	AdditionalProperties: hubbub.Bool(false),
+}
+
+// goals lists the goals served by TravisService
+var goals = []hubbub.GoalDefinition{
+	{
+		Name:        "travis_repository_settings",
+		Description: "Update Travis repository settings.",
+		Schema:      repositorySettingsSchema,
+		Example: `{
+  "build_pushes": true,
+  "build_pull_requests": true
+}`,
+	},
+	{
+		Name:        "travis_env_var",
+		Description: "Define Travis environment variables. Private variables are always updated, as Travis doesn't reveal their values.",
+		Schema:      envVarSchema,
+		Example: `{
+  "state": "present",
+  "name": "NODE_ENV",
+  "value": "test",
+  "public": true
+}`,
+	},
+}
@@ -0,0 +1,26 @@
+package travis_service
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestGoalExamplesAreValid(t *testing.T) {
+	for _, d := range goals {
+		if err := d.Validate(json.RawMessage(d.Example)); err != nil {
+			t.Error("expected", d.Name, "example to be valid, got", err)
+		}
+	}
+}
+
+func TestRepositorySettingsSchema(t *testing.T) {
+	valid := `{"build_pushes":true,"maximum_number_of_builds":2}`
+	if err := repositorySettingsSchema.Validate(json.RawMessage(valid)); err != nil {
+		t.Error("expected", valid, "to be valid, got", err)
+	}
+
+	invalid := `{"maximum_number_of_build":2}`
+	if err := repositorySettingsSchema.Validate(json.RawMessage(invalid)); err == nil {
+		t.Error("expected", invalid, "to be invalid")
+	}
+}
@@ -15,6 +15,8 @@ type TravisService struct {
 	Client        *travis.Client
 	RepoID        int
 	EnvVarService *EnvVarService
+	DryRun        bool
+	Retry         *hubbub.RetryPolicy
 }
 
 // repositorySettingsParams describe the state of repository settings in travis
@@ -46,7 +48,11 @@ func parseEnvVarParams(rawGoal *json.RawMessage) (*envVarParams, error) {
 
 // configureRepositoryId configures the repo's travis-ci ID for the service
 func (ts *TravisService) configureRepositoryId(owner, name string) error {
-	travisRepo, err := ts.Client.GetRepository(owner, name)
+	var travisRepo *travis.Repository
+	err := ts.Retry.Do(hubbub.RetryableError, func() (err error) {
+		travisRepo, err = ts.Client.GetRepository(owner, name)
+		return
+	})
 	if err != nil {
 		return err
 	}
@@ -55,29 +61,51 @@ func (ts *TravisService) configureRepositoryId(owner, name string) error {
 }
 
 // repositorySettings updates settings to match the provided goal
-func (ts *TravisService) repositorySettings(rawGoal *json.RawMessage) error {
+func (ts *TravisService) repositorySettings(rawGoal *json.RawMessage) ([]hubbub.Change, error) {
 	settings, err := parseRepositorySettingsParams(rawGoal)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	var current *travis.RepositorySettings
+	err = ts.Retry.Do(hubbub.RetryableError, func() (err error) {
+		current, err = ts.Client.GetRepositorySettings(ts.RepoID)
+		return
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	travisSettings := travis.RepositorySettings(*settings)
-	_, updateErr := ts.Client.UpdateRepositorySettings(ts.RepoID, &travisSettings)
-	return updateErr
+	changes := []hubbub.Change{{Resource: "settings", Action: hubbub.Update, Before: current, After: travisSettings}}
+	if hubbub.SettingsMatch(current, &travisSettings) {
+		changes[0].Action = hubbub.Unchanged
+		return changes, nil
+	}
+
+	if ts.DryRun {
+		return changes, nil
+	}
+
+	updateErr := ts.Retry.Do(hubbub.RetryableError, func() error {
+		_, err := ts.Client.UpdateRepositorySettings(ts.RepoID, &travisSettings)
+		return err
+	})
+	return changes, updateErr
 }
 
-func (ts *TravisService) envVar(rawGoal *json.RawMessage) error {
+func (ts *TravisService) envVar(rawGoal *json.RawMessage) ([]hubbub.Change, error) {
 	params, err := parseEnvVarParams(rawGoal)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// lazily configure the var service, allowing other travis-related tasks to
 	// be completed without fetching environment variables
 	if ts.EnvVarService == nil {
-		evs, err := NewEnvVarService(ts.Client, ts.RepoID)
+		evs, err := NewEnvVarService(ts.Client, ts.RepoID, ts.DryRun, ts.Retry)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		ts.EnvVarService = evs
 	}
@@ -88,21 +116,20 @@ func (ts *TravisService) envVar(rawGoal *json.RawMessage) error {
 	case "absent":
 		return ts.EnvVarService.RemoveByName(*params.EnvironmentVariable.Name)
 	default:
-		return errors.New("unknown state.")
+		return nil, errors.New("unknown state.")
 	}
 }
 
 // Do executes a single policy goal
-func (ts *TravisService) Do(name string, rawGoal *json.RawMessage) error {
+func (ts *TravisService) Do(name string, rawGoal *json.RawMessage) ([]hubbub.Change, error) {
 	switch name {
 	case "travis_env_var":
 		return ts.envVar(rawGoal)
 	case "travis_repository_settings":
 		return ts.repositorySettings(rawGoal)
 	default:
-		return errors.New("unknown goal (this shouldn't happen..)")
+		return nil, errors.New("unknown goal (this shouldn't happen..)")
 	}
-	return nil
 }
 
 // configureClient attempts to access the travis API with the specified token.
@@ -129,7 +156,7 @@ var configureClient = func(ts *TravisService, client *travis.Client, owner, name
 // pro / travis.com.
 func TravisServiceFactory(facts *hubbub.Facts) (*hubbub.Service, error) {
 
-	ts := TravisService{}
+	ts := TravisService{DryRun: facts.IsDryRun(), Retry: hubbub.NewRetryPolicy(facts)}
 	owner := facts.GetString("repo.owner")
 	name := facts.GetString("repo.name")
 
@@ -149,8 +176,5 @@ func TravisServiceFactory(facts *hubbub.Facts) (*hubbub.Service, error) {
 }
 
 func init() {
-	hubbub.RegisterService([]string{
-		"travis_repository_settings",
-		"travis_env_var",
-	}, TravisServiceFactory)
+	hubbub.RegisterService(goals, TravisServiceFactory)
 }
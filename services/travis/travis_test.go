@@ -1,6 +1,7 @@
 package travis_service
 
 import (
+	"encoding/json"
 	"github.com/rjz/go-travis/travis"
 	hubbub "github.com/rjz/hubbub/common"
 	"testing"
@@ -56,3 +57,23 @@ func TestTravisServiceFactoryProToken(t *testing.T) {
 		t.Fatal("expected pass, didn't get it.")
 	}
 }
+
+func settingsFixture(t *testing.T, data string) *travis.RepositorySettings {
+	settings := travis.RepositorySettings{}
+	if err := json.Unmarshal([]byte(data), &settings); err != nil {
+		t.Fatal(err)
+	}
+	return &settings
+}
+
+func TestSettingsMatch(t *testing.T) {
+	current := settingsFixture(t, `{"build_pushes":true,"build_pull_requests":false}`)
+
+	if !hubbub.SettingsMatch(current, settingsFixture(t, `{"build_pushes":true}`)) {
+		t.Error("expected match, didn't get it.")
+	}
+
+	if hubbub.SettingsMatch(current, settingsFixture(t, `{"build_pull_requests":true}`)) {
+		t.Error("expected mismatch, didn't get it.")
+	}
+}